@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/progress"
+	"projects/internal/reconcile"
+	"projects/internal/taskbackend"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/logger"
+	"projects/pkg/taskclient"
+)
+
+// reconcile prints the differences between task_entities and the task service
+// as JSON and exits with 1 when there are any, --repair fixes them and exits
+// with 1 when a fix failed. Flags take two dashes and the --name=value form,
+// single dash arguments are configuration overrides.
+func main() {
+	repair := flag.Bool("repair", false, "fix the differences found")
+	timeout := flag.Duration("timeout", 10*time.Minute, "abort after this long")
+	flag.CommandLine.Parse(doubleDashArgs(os.Args[1:]))
+
+	var (
+		dbi    db.DbInter
+		client taskclient.Client
+		conf   *config.Tuner
+		logr   *logrus.Logger
+	)
+	app := fx.New(
+		config.Module,
+		db.Module,
+		logger.Module,
+		progress.Module,
+		taskbackend.Module,
+		fx.NopLogger,
+		fx.Populate(&dbi, &client, &conf, &logr),
+	)
+	if err := app.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report, err := reconcile.New(dbi.GetDB(), client, logr).Run(taskclient.WithServiceAuth(ctx, conf), *repair)
+	dbi.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if (!report.Clean() && !*repair) || len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// doubleDashArgs keeps the --flag arguments, the rest belongs to config.Tuner.
+func doubleDashArgs(args []string) []string {
+	var res []string
+	for _, a := range args {
+		if len(a) > 2 && a[:2] == "--" {
+			res = append(res, a)
+		}
+	}
+	return res
+}
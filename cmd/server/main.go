@@ -2,7 +2,10 @@ package main
 
 import (
 	"projects/internal/handlers"
+	"projects/internal/jobs"
+	"projects/internal/progress"
 	"projects/internal/router"
+	"projects/internal/taskbackend"
 
 	"projects/pkg"
 
@@ -14,6 +17,9 @@ func main() {
 		router.Module,
 		pkg.Modules,
 		handlers.Modules,
+		jobs.Module,
+		progress.Module,
+		taskbackend.Module,
 	)
 	app.Run()
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"projects/pkg/taskstub"
+)
+
+// taskstub serves an in-memory task service, point Task.Addr at it.
+func main() {
+	addr := flag.String("addr", ":8082", "listen address")
+	latency := flag.Duration("latency", 0, "delay added to every request")
+	jitter := flag.Duration("jitter", 0, "random extra delay up to this long")
+	failureRate := flag.Float64("failure-rate", 0, "share of requests failing, 0..1")
+	failureStatus := flag.Int("failure-status", http.StatusServiceUnavailable, "status of injected failures")
+	webhookURL := flag.String("webhook-url", "", "projects webhook endpoint, e.g. http://localhost:8081/api/projects/webhooks/tasks")
+	webhookSecret := flag.String("webhook-secret", "", "secret shared with Task.WebhookSecret")
+	flag.Parse()
+
+	stub := taskstub.New(taskstub.Options{
+		Latency:       *latency,
+		Jitter:        *jitter,
+		FailureRate:   *failureRate,
+		FailureStatus: *failureStatus,
+		WebhookURL:    *webhookURL,
+		WebhookSecret: *webhookSecret,
+	})
+	log.Println("task stub listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, stub))
+}
@@ -0,0 +1,232 @@
+// Package access checks the workspace role of the caller before a handler
+// changes workspace scoped data.
+package access
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"projects/internal/database/actionPlan"
+	"projects/internal/database/epics"
+	"projects/internal/database/membership"
+	"projects/internal/database/milestone"
+	"projects/internal/database/projects"
+	"projects/internal/database/stage"
+	"projects/internal/database/tasks"
+	"projects/internal/database/workspace"
+	"projects/pkg/auth"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrForbidden = errors.New("not enough rights in the workspace")
+	ErrNotFound  = errors.New("not found")
+)
+
+// UserID returns the subject of the bearer token. It is empty for anonymous
+// callers, who are members of no workspace. Handlers never take the caller
+// from the request itself.
+func UserID(c *gin.Context) string {
+	return auth.UserID(c)
+}
+
+// Named returns the caller, or the user named in the path of a read when auth
+// is disabled.
+func Named(c *gin.Context, named string) string {
+	if auth.Authenticated(c) {
+		return UserID(c)
+	}
+	return named
+}
+
+// Company returns the company claim of the token, empty for anonymous callers.
+func Company(c *gin.Context) string {
+	return auth.Company(c)
+}
+
+// Caller identifies the request for events it publishes.
+func Caller(c *gin.Context) events.Caller {
+	return events.Caller{Authorization: c.GetHeader("Authorization"), UserID: UserID(c), Company: Company(c)}
+}
+
+// TaskContext carries the Authorization header and the company of the caller
+// to task service calls, cached tasks are kept apart per company.
+func TaskContext(c *gin.Context) context.Context {
+	ctx := taskclient.WithAuthorization(c.Request.Context(), c.GetHeader("Authorization"))
+	return taskclient.WithCompany(ctx, Company(c))
+}
+
+// Checker resolves the workspace of an entity and the role of the caller in
+// it. The bool methods answer the request themselves when the check fails,
+// handlers just return.
+type Checker struct {
+	db  *gorm.DB
+	log *logrus.Logger
+}
+
+func New(db *gorm.DB, log *logrus.Logger) Checker {
+	return Checker{db: db, log: log}
+}
+
+// Allowed requires the caller to hold at least need in the workspace.
+// Workspaces without members are open to everyone, as is workspace 0 of data
+// created before workspaces.
+func (a Checker) Allowed(c *gin.Context, workspaceID int64, need membership.Role) error {
+	if workspaceID == 0 {
+		return nil
+	}
+	role, open, err := membership.New(a.db).Role(workspaceID, UserID(c))
+	if err != nil {
+		return err
+	}
+	if open || role.Allows(need) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// MilestoneAllowed is Allowed for the workspace of a milestone with the
+// editor role.
+func (a Checker) MilestoneAllowed(c *gin.Context, id int64) error {
+	return a.entityAllowed(c, milestone.MilestoneEntity{}, "milestone_id", id)
+}
+
+func (a Checker) Workspace(c *gin.Context, workspaceID int64, need membership.Role) bool {
+	return a.answer(c, a.Allowed(c, workspaceID, need))
+}
+
+// Administer requires the admin role in the workspace. Open workspaces have no
+// admin yet, there only the owner of the project may seed the membership.
+func (a Checker) Administer(c *gin.Context, ws workspace.WorkspaceEntity) bool {
+	user := UserID(c)
+	role, open, err := membership.New(a.db).Role(ws.WorkspaceID, user)
+	if err != nil {
+		return a.answer(c, err)
+	}
+	if !open {
+		if role.Allows(membership.Admin) {
+			return true
+		}
+		return a.answer(c, ErrForbidden)
+	}
+	if user == "" || ws.ProjectID == 0 {
+		return a.answer(c, ErrForbidden)
+	}
+	project, err := projects.New(a.db).Get(ws.ProjectID)
+	if err != nil {
+		return a.answer(c, err)
+	}
+	if project.OwnerID != user {
+		return a.answer(c, ErrForbidden)
+	}
+	return true
+}
+
+// Project requires need in every workspace of the project.
+func (a Checker) Project(c *gin.Context, projectID int64, need membership.Role) bool {
+	ws, err := workspace.New(a.db).GetByProjectID(projectID)
+	if err != nil {
+		return a.answer(c, err)
+	}
+	for _, w := range ws {
+		if !a.Workspace(c, w.WorkspaceID, need) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddWorkspace lets the owner of the project add workspaces to it, anybody
+// else needs the admin role in all of its workspaces. A project without
+// workspaces is left to its owner.
+func (a Checker) AddWorkspace(c *gin.Context, project projects.ProjectEntity) bool {
+	user := UserID(c)
+	if user != "" && project.OwnerID == user {
+		return true
+	}
+	ws, err := workspace.New(a.db).GetByProjectID(project.ProjectID)
+	if err != nil {
+		return a.answer(c, err)
+	}
+	if len(ws) == 0 {
+		return a.answer(c, ErrForbidden)
+	}
+	return a.Project(c, project.ProjectID, membership.Admin)
+}
+
+func (a Checker) EditActionPlan(c *gin.Context, id int64) bool {
+	return a.answer(c, a.entityAllowed(c, actionPlan.ActionPlanEntity{}, "action_plan_id", id))
+}
+
+func (a Checker) EditStage(c *gin.Context, id int64) bool {
+	return a.answer(c, a.entityAllowed(c, stage.StageEntity{}, "stage_id", id))
+}
+
+func (a Checker) EditMilestone(c *gin.Context, id int64) bool {
+	return a.answer(c, a.MilestoneAllowed(c, id))
+}
+
+func (a Checker) EditEpic(c *gin.Context, id int64) bool {
+	return a.answer(c, a.entityAllowed(c, epics.EpicEntity{}, "id", id))
+}
+
+// EditTask checks the milestone the task is mapped to.
+func (a Checker) EditTask(c *gin.Context, id int64) bool {
+	task, err := tasks.New(a.db).GetTaskByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return a.answer(c, ErrNotFound)
+	}
+	if err != nil {
+		return a.answer(c, err)
+	}
+	return a.EditMilestone(c, task.MilestoneID)
+}
+
+// EditMilestones requires the editor role in the workspaces of all given
+// milestones, unknown ids are left to the handler.
+func (a Checker) EditMilestones(c *gin.Context, ids []int64) bool {
+	var workspaceIDs []int64
+	if err := a.db.Model(milestone.MilestoneEntity{}).Where("milestone_id IN ?", ids).
+		Distinct().Pluck("COALESCE(workspace_id, 0)", &workspaceIDs).Error; err != nil {
+		return a.answer(c, err)
+	}
+	for _, id := range workspaceIDs {
+		if !a.Workspace(c, id, membership.Editor) {
+			return false
+		}
+	}
+	return true
+}
+
+// entityAllowed requires the editor role in the workspace the row belongs to.
+func (a Checker) entityAllowed(c *gin.Context, model interface{}, column string, id int64) error {
+	var workspaceIDs []int64
+	if err := a.db.Model(model).Where(column+" = ?", id).Limit(1).
+		Pluck("COALESCE(workspace_id, 0)", &workspaceIDs).Error; err != nil {
+		return err
+	}
+	if len(workspaceIDs) == 0 {
+		return ErrNotFound
+	}
+	return a.Allowed(c, workspaceIDs[0], membership.Editor)
+}
+
+func (a Checker) answer(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		a.log.Warnln("access check err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+	return false
+}
@@ -37,6 +37,7 @@ type ActionPlanInter interface {
 	Update(id int64, title string, status string) (ActionPlanEntity, error)
 	Get(id int64) (ActionPlanEntity, error)
 	GetByProjectID(projectID int64) ([]ActionPlanEntity, error)
+	GetByWorkspaceID(workspaceID int64) ([]ActionPlanEntity, error)
 }
 
 type ActionPlanEntity struct {
@@ -94,6 +95,15 @@ func (aP actionPlan) GetByProjectID(projectID int64) ([]ActionPlanEntity, error)
 	return acPlan, nil
 }
 
+func (aP actionPlan) GetByWorkspaceID(workspaceID int64) ([]ActionPlanEntity, error) {
+	var acPlan []ActionPlanEntity
+
+	if err := aP.db.Where("workspace_id = ?", workspaceID).Order("action_plan_id").Find(&acPlan).Error; err != nil {
+		return []ActionPlanEntity{}, err
+	}
+	return acPlan, nil
+}
+
 func (aP actionPlan) Delete(id int64) error {
 	if err := aP.db.Delete(ActionPlanEntity{}, id).Error; err != nil {
 		return err
@@ -0,0 +1,138 @@
+package assignment
+
+import (
+	"database/sql/driver"
+	"time"
+
+	"gorm.io/gorm"
+
+	"projects/internal/database/milestone"
+)
+
+type Role string
+
+const (
+	Owner       Role = "owner"
+	Contributor Role = "contributor"
+	Reviewer    Role = "reviewer"
+)
+
+func (r *Role) Scan(value interface{}) error {
+	*r = Role(value.(string))
+	return nil
+}
+
+func (r Role) Value() (driver.Value, error) {
+	return string(r), nil
+}
+
+func (r *Role) String() string {
+	return string(*r)
+}
+
+type AssignmentInter interface {
+	Add(a *AssignmentEntity) error
+	Remove(milestoneID int64, userID string, role Role) error
+	GetByMilestoneID(milestoneID int64) ([]AssignmentEntity, error)
+	GetByMilestoneIDs(milestoneIDs []int64) (map[int64][]AssignmentEntity, error)
+	GetMilestonesByUser(userID string, role Role) ([]milestone.MilestoneEntity, error)
+}
+
+type AssignmentEntity struct {
+	ID          int64  `gorm:"column:id;primary_key;autoIncrement"`
+	MilestoneID int64  `gorm:"column:milestone_id;uniqueIndex:idx_milestone_assignment"`
+	UserID      string `gorm:"column:user_id;uniqueIndex:idx_milestone_assignment;index"`
+	Role        Role   `gorm:"column:role;type:enum_assign_role;uniqueIndex:idx_milestone_assignment"`
+	Created     int64  `gorm:"column:created"`
+}
+
+func (AssignmentEntity) TableName() string {
+	return "milestone_assignment"
+}
+
+func (a *AssignmentEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	a.Created = time.Now().Unix()
+	return
+}
+
+type assignment struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) AssignmentInter {
+
+	return &assignment{db: dbr}
+}
+
+// Add assigns the user to the milestone. A milestone has a single owner, so a new
+// owner replaces the previous one and is mirrored into milestone.assign_id.
+func (a assignment) Add(ae *AssignmentEntity) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if ae.Role == Owner {
+			if err := tx.Where("milestone_id = ? and role = ?", ae.MilestoneID, Owner).Delete(AssignmentEntity{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(milestone.MilestoneEntity{}).Where("milestone_id = ?", ae.MilestoneID).
+				Update("assign_id", ae.UserID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where(AssignmentEntity{MilestoneID: ae.MilestoneID, UserID: ae.UserID, Role: ae.Role}).
+			FirstOrCreate(ae).Error
+	})
+}
+
+func (a assignment) Remove(milestoneID int64, userID string, role Role) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("milestone_id = ? and user_id = ?", milestoneID, userID)
+		if role != "" {
+			query = query.Where("role = ?", role)
+		}
+		if err := query.Delete(AssignmentEntity{}).Error; err != nil {
+			return err
+		}
+		if role == "" || role == Owner {
+			return tx.Model(milestone.MilestoneEntity{}).Where("milestone_id = ? and assign_id = ?", milestoneID, userID).
+				Update("assign_id", "").Error
+		}
+		return nil
+	})
+}
+
+func (a assignment) GetByMilestoneID(milestoneID int64) ([]AssignmentEntity, error) {
+	var assignments []AssignmentEntity
+	if err := a.db.Where("milestone_id = ?", milestoneID).Order("role, created").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func (a assignment) GetByMilestoneIDs(milestoneIDs []int64) (map[int64][]AssignmentEntity, error) {
+	byMilestone := make(map[int64][]AssignmentEntity)
+	if len(milestoneIDs) == 0 {
+		return byMilestone, nil
+	}
+	var assignments []AssignmentEntity
+	if err := a.db.Where("milestone_id IN ?", milestoneIDs).Order("role, created").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range assignments {
+		byMilestone[v.MilestoneID] = append(byMilestone[v.MilestoneID], v)
+	}
+	return byMilestone, nil
+}
+
+func (a assignment) GetMilestonesByUser(userID string, role Role) ([]milestone.MilestoneEntity, error) {
+	var miles []milestone.MilestoneEntity
+	query := a.db.Model(milestone.MilestoneEntity{}).
+		Joins("JOIN milestone_assignment ma ON ma.milestone_id = milestone.milestone_id").
+		Where("ma.user_id = ? and milestone.hidden = false", userID)
+	if role != "" {
+		query = query.Where("ma.role = ?", role)
+	}
+	if err := query.Distinct("milestone.*").Order("milestone.project_id, milestone.date_stop").Find(&miles).Error; err != nil {
+		return nil, err
+	}
+	return miles, nil
+}
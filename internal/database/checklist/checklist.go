@@ -0,0 +1,103 @@
+package checklist
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ChecklistInter interface {
+	Create(items []ChecklistItemEntity) ([]ChecklistItemEntity, error)
+	Get(id int64) (ChecklistItemEntity, error)
+	GetByMilestoneID(milestoneID int64) ([]ChecklistItemEntity, error)
+	Update(id int64, updateColumns map[string]interface{}) (ChecklistItemEntity, error)
+	Check(id int64, done bool, userID string) (ChecklistItemEntity, error)
+	Delete(id int64) error
+	CountOpenRequired(milestoneID int64) (int64, error)
+}
+
+type ChecklistItemEntity struct {
+	ID          int64  `gorm:"column:id;primary_key;autoIncrement"`
+	MilestoneID int64  `gorm:"column:milestone_id;index"`
+	Title       string `gorm:"column:title"`
+	Order       int    `gorm:"column:order"`
+	Required    bool   `gorm:"column:required;default:false"`
+	Done        bool   `gorm:"column:done;default:false"`
+	DoneBy      string `gorm:"column:done_by"`
+	DoneAt      int64  `gorm:"column:done_at"`
+	Created     int64  `gorm:"column:created"`
+}
+
+func (ChecklistItemEntity) TableName() string {
+	return "milestone_checklist"
+}
+
+func (c *ChecklistItemEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	c.Created = time.Now().Unix()
+	return
+}
+
+type checklist struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) ChecklistInter {
+
+	return &checklist{db: dbr}
+}
+
+func (cl checklist) Create(items []ChecklistItemEntity) ([]ChecklistItemEntity, error) {
+	if err := cl.db.Create(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (cl checklist) Get(id int64) (ChecklistItemEntity, error) {
+	var item ChecklistItemEntity
+	if err := cl.db.Where("id = ?", id).First(&item).Error; err != nil {
+		return ChecklistItemEntity{}, err
+	}
+	return item, nil
+}
+
+func (cl checklist) GetByMilestoneID(milestoneID int64) ([]ChecklistItemEntity, error) {
+	var items []ChecklistItemEntity
+	if err := cl.db.Where("milestone_id = ?", milestoneID).Order(`"order", id`).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (cl checklist) Update(id int64, updateColumns map[string]interface{}) (ChecklistItemEntity, error) {
+	if len(updateColumns) > 0 {
+		if err := cl.db.Model(ChecklistItemEntity{}).Where("id = ?", id).Updates(updateColumns).Error; err != nil {
+			return ChecklistItemEntity{}, err
+		}
+	}
+	return cl.Get(id)
+}
+
+// Check marks the item as done by the user or reopens it.
+func (cl checklist) Check(id int64, done bool, userID string) (ChecklistItemEntity, error) {
+	updates := map[string]interface{}{"done": done, "done_by": "", "done_at": 0}
+	if done {
+		updates["done_by"] = userID
+		updates["done_at"] = time.Now().Unix()
+	}
+	return cl.Update(id, updates)
+}
+
+func (cl checklist) Delete(id int64) error {
+	return cl.db.Where("id = ?", id).Delete(ChecklistItemEntity{}).Error
+}
+
+func (cl checklist) CountOpenRequired(milestoneID int64) (int64, error) {
+	var count int64
+	if err := cl.db.Model(ChecklistItemEntity{}).
+		Where("milestone_id = ? and required = true and done = false", milestoneID).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
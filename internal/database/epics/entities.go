@@ -9,4 +9,7 @@ type EpicEntity struct {
 	MilestoneID  int64  `gorm:"milestone_id"`
 	Title        string `gorm:"title"`
 	Description  string `gorm:"description"`
+	Status       string `gorm:"column:status;type:enum_status;default:'new'"` // a milestone.Status value
+	Order        int    `gorm:"column:order"`
+	Hidden       bool   `gorm:"column:hidden;default:false"`
 }
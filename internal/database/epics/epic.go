@@ -1,14 +1,28 @@
 package epics
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
+
+	"projects/internal/database/tags"
 )
 
 type Epic interface {
 	CreateEpic(epicEntity EpicEntity) (EpicEntity, error)
-	GetEpic(epicEntity EpicEntity) ([]EpicEntity, error)
+	GetEpic(epicEntity EpicEntity, tagIDs ...int64) ([]EpicEntity, error)
+	GetEpicByID(id int64) (EpicEntity, error)
 	UpdateEpic(entity EpicEntity) error
 	DeleteEpic(id int64) error
+	Move(id, milestoneID int64) (EpicEntity, []int64, error)
+}
+
+// parent is the part of a milestone row an epic inherits.
+type parent struct {
+	StageID      int64
+	ActionPlanID int64
+	WorkspaceID  int64
+	ProjectID    int64
 }
 
 func NewEpic(db *gorm.DB) Epic {
@@ -19,25 +33,111 @@ type epic struct {
 	db *gorm.DB
 }
 
+// CreateEpic appends the epic to the end of its milestone unless an order is given.
 func (e *epic) CreateEpic(epicEntity EpicEntity) (EpicEntity, error) {
+	if epicEntity.Order == 0 && epicEntity.MilestoneID > 0 {
+		var last int
+		e.db.Model(EpicEntity{}).Select(`COALESCE(MAX("order"), 0)`).
+			Where("milestone_id = ? and hidden = false", epicEntity.MilestoneID).Scan(&last)
+		epicEntity.Order = last + 1
+	}
+	if epicEntity.MilestoneID > 0 {
+		par, err := e.milestoneParent(epicEntity.MilestoneID)
+		if err != nil {
+			return EpicEntity{}, err
+		}
+		epicEntity.StageID = par.StageID
+		epicEntity.ActionPlanID = par.ActionPlanID
+		epicEntity.WorkspaceID = par.WorkspaceID
+		epicEntity.ProjectID = par.ProjectID
+	}
 	if err := e.db.Create(&epicEntity).Error; err != nil {
 		return EpicEntity{}, err
 	}
 	return epicEntity, nil
 }
 
-func (e *epic) GetEpic(epicEntity EpicEntity) ([]EpicEntity, error) {
+func (e *epic) GetEpic(epicEntity EpicEntity, tagIDs ...int64) ([]EpicEntity, error) {
 	var epicEntities []EpicEntity
-	if err := e.db.Find(&epicEntities, epicEntity).Error; err != nil {
+	query := tags.Filter(e.db.Where("hidden = false"), tags.Epic, "id", tagIDs)
+	if err := query.Order(`"order", id`).Find(&epicEntities, epicEntity).Error; err != nil {
 		return nil, err
 	}
 	return epicEntities, nil
 }
 
+func (e *epic) GetEpicByID(id int64) (EpicEntity, error) {
+	var epicEntity EpicEntity
+	if err := e.db.Where("id = ? and hidden = false", id).First(&epicEntity).Error; err != nil {
+		return EpicEntity{}, err
+	}
+	return epicEntity, nil
+}
+
 func (e *epic) UpdateEpic(entity EpicEntity) error {
 	return e.db.Updates(entity).Error
 }
 
+// DeleteEpic hides the epic, its tasks are handled by the caller.
 func (e *epic) DeleteEpic(id int64) error {
-	return e.db.Delete(EpicEntity{}, id).Error
+	return e.db.Model(EpicEntity{}).Where("id = ?", id).Update("hidden", true).Error
+}
+
+// Move re-parents the epic and its tasks to another milestone and puts the epic
+// at the end of it. It returns the moved task ids, run it inside a transaction.
+func (e *epic) Move(id, milestoneID int64) (EpicEntity, []int64, error) {
+	epicEntity, err := e.GetEpicByID(id)
+	if err != nil {
+		return EpicEntity{}, nil, err
+	}
+	par, err := e.milestoneParent(milestoneID)
+	if err != nil {
+		return EpicEntity{}, nil, err
+	}
+	var last int
+	e.db.Model(EpicEntity{}).Select(`COALESCE(MAX("order"), 0)`).
+		Where("milestone_id = ? and hidden = false", milestoneID).Scan(&last)
+
+	if err := e.db.Model(EpicEntity{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"milestone_id":   milestoneID,
+		"stage_id":       par.StageID,
+		"action_plan_id": par.ActionPlanID,
+		"workspace_id":   par.WorkspaceID,
+		"project_id":     par.ProjectID,
+		"order":          last + 1,
+	}).Error; err != nil {
+		return EpicEntity{}, nil, err
+	}
+
+	var taskIDs []int64
+	if err := e.db.Table("task_entities").Where("epic_id = ?", id).Pluck("id", &taskIDs).Error; err != nil {
+		return EpicEntity{}, nil, err
+	}
+	if err := e.db.Table("task_entities").Where("epic_id = ?", id).Updates(map[string]interface{}{
+		"milestone_id":   milestoneID,
+		"action_plan_id": par.ActionPlanID,
+	}).Error; err != nil {
+		return EpicEntity{}, nil, err
+	}
+
+	epicEntity.MilestoneID = milestoneID
+	epicEntity.StageID = par.StageID
+	epicEntity.ActionPlanID = par.ActionPlanID
+	epicEntity.WorkspaceID = par.WorkspaceID
+	epicEntity.ProjectID = par.ProjectID
+	epicEntity.Order = last + 1
+	return epicEntity, taskIDs, nil
+}
+
+func (e *epic) milestoneParent(milestoneID int64) (parent, error) {
+	var par parent
+	res := e.db.Table("milestone").Select("stage_id, action_plan_id, workspace_id, project_id").
+		Where("milestone_id = ? and hidden = false", milestoneID).Scan(&par)
+	if res.Error != nil {
+		return parent{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return parent{}, errors.New("milestone not found")
+	}
+	return par, nil
 }
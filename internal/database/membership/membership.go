@@ -0,0 +1,149 @@
+package membership
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Role string
+
+const (
+	Viewer Role = "viewer"
+	Editor Role = "editor"
+	Admin  Role = "admin"
+)
+
+var (
+	ErrBadRole = errors.New("role must be viewer, editor or admin")
+	// ErrLastAdmin is returned when a workspace with members would be left
+	// without an admin.
+	ErrLastAdmin = errors.New("a workspace with members keeps at least one admin")
+)
+
+func (r *Role) Scan(value interface{}) error {
+	*r = Role(value.(string))
+	return nil
+}
+
+func (r Role) Value() (driver.Value, error) {
+	return string(r), nil
+}
+
+func (r *Role) String() string {
+	return string(*r)
+}
+
+// ParseRole validates an enum_ws_role value.
+func ParseRole(value string) (Role, error) {
+	if r := Role(value); rank[r] > 0 {
+		return r, nil
+	}
+	return "", ErrBadRole
+}
+
+// Allows reports whether the role grants at least need.
+func (r Role) Allows(need Role) bool {
+	return rank[r] >= rank[need] && rank[need] > 0
+}
+
+var rank = map[Role]int{Viewer: 1, Editor: 2, Admin: 3}
+
+type MembershipInter interface {
+	Set(m *MemberEntity) error
+	Remove(workspaceID int64, userID string) error
+	GetByWorkspaceID(workspaceID int64) ([]MemberEntity, error)
+	Role(workspaceID int64, userID string) (role Role, open bool, err error)
+}
+
+type MemberEntity struct {
+	ID          int64  `gorm:"column:id;primary_key;autoIncrement"`
+	WorkspaceID int64  `gorm:"column:workspace_id;uniqueIndex:idx_workspace_member"`
+	UserID      string `gorm:"column:user_id;uniqueIndex:idx_workspace_member;index"`
+	Role        Role   `gorm:"column:role;type:enum_ws_role"`
+	Created     int64  `gorm:"column:created"`
+}
+
+func (MemberEntity) TableName() string {
+	return "workspace_member"
+}
+
+func (m *MemberEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	m.Created = time.Now().Unix()
+	return
+}
+
+type membership struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) MembershipInter {
+
+	return &membership{db: dbr}
+}
+
+// Set adds the user to the workspace or changes the role of a member.
+func (s membership) Set(m *MemberEntity) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role"}),
+		}).Create(m).Error; err != nil {
+			return err
+		}
+		return keepsAdmin(tx, m.WorkspaceID)
+	})
+}
+
+func (s membership) Remove(workspaceID int64, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ? and user_id = ?", workspaceID, userID).Delete(MemberEntity{}).Error; err != nil {
+			return err
+		}
+		return keepsAdmin(tx, workspaceID)
+	})
+}
+
+// keepsAdmin fails when the workspace is left with members but no admin.
+func keepsAdmin(tx *gorm.DB, workspaceID int64) error {
+	var members, admins int64
+	if err := tx.Model(MemberEntity{}).Where("workspace_id = ?", workspaceID).Count(&members).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(MemberEntity{}).Where("workspace_id = ? and role = ?", workspaceID, Admin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if members > 0 && admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func (s membership) GetByWorkspaceID(workspaceID int64) ([]MemberEntity, error) {
+	var members []MemberEntity
+	if err := s.db.Where("workspace_id = ?", workspaceID).Order("role, created").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Role returns the role of the user in the workspace. A workspace without
+// members is open, everyone may edit it.
+func (s membership) Role(workspaceID int64, userID string) (Role, bool, error) {
+	var members []MemberEntity
+	if err := s.db.Where("workspace_id = ?", workspaceID).Find(&members).Error; err != nil {
+		return "", false, err
+	}
+	if len(members) == 0 {
+		return "", true, nil
+	}
+	for _, m := range members {
+		if m.UserID == userID {
+			return m.Role, false, nil
+		}
+	}
+	return "", false, nil
+}
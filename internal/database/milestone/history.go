@@ -0,0 +1,102 @@
+package milestone
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"projects/internal/database/checklist"
+)
+
+// ErrChecklistIncomplete is returned when a milestone that requires its
+// checklist is completed while required items are still open.
+var ErrChecklistIncomplete = errors.New("required checklist items are not done")
+
+type StatusHistoryEntity struct {
+	ID          int64  `gorm:"column:id;primary_key;autoIncrement"`
+	MilestoneID int64  `gorm:"column:milestone_id;index"`
+	From        Status `gorm:"column:from_status"`
+	To          Status `gorm:"column:to_status"`
+	UserID      string `gorm:"column:user_id"`
+	Comment     string `gorm:"column:comment"`
+	Created     int64  `gorm:"column:created"`
+}
+
+func (StatusHistoryEntity) TableName() string {
+	return "milestone_status_history"
+}
+
+func (h *StatusHistoryEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	h.Created = time.Now().Unix()
+	return
+}
+
+// ChangeStatus sets the milestone status, records the transition and captures
+// the actual start/finish time. Nothing is written when the status is unchanged.
+func (s milestone) ChangeStatus(milestoneID int64, to Status, userID, comment string) (MilestoneEntity, error) {
+	var ms MilestoneEntity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("milestone_id = ?", milestoneID).First(&ms).Error; err != nil {
+			return err
+		}
+		if ms.Status == to {
+			return nil
+		}
+		if to == Completed && ms.RequireChecklist {
+			open, err := checklist.New(tx).CountOpenRequired(milestoneID)
+			if err != nil {
+				return err
+			}
+			if open > 0 {
+				return ErrChecklistIncomplete
+			}
+		}
+
+		now := time.Now().Unix()
+		updates := map[string]interface{}{"status": to}
+		switch to {
+		case InProgress:
+			if ms.ActualStart == 0 {
+				updates["actual_start"] = now
+			}
+			updates["actual_finish"] = 0
+		case Completed:
+			if ms.ActualStart == 0 {
+				updates["actual_start"] = now
+			}
+			updates["actual_finish"] = now
+			updates["overdue"] = false
+			updates["completion_proposed"] = false
+		case Cancelled:
+			updates["overdue"] = false
+			updates["completion_proposed"] = false
+		}
+		if err := tx.Model(MilestoneEntity{}).Where("milestone_id = ?", milestoneID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&StatusHistoryEntity{
+			MilestoneID: milestoneID,
+			From:        ms.Status,
+			To:          to,
+			UserID:      userID,
+			Comment:     comment,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("milestone_id = ?", milestoneID).First(&ms).Error
+	})
+	if err != nil {
+		return MilestoneEntity{}, err
+	}
+	return ms, nil
+}
+
+func (s milestone) GetStatusHistory(milestoneID int64) ([]StatusHistoryEntity, error) {
+	var history []StatusHistoryEntity
+	if err := s.db.Where("milestone_id = ?", milestoneID).Order("created, id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -2,11 +2,15 @@ package milestone
 
 import (
 	"database/sql/driver"
+	"errors"
 
 	"gorm.io/gorm"
 
+	"projects/internal/database/epics"
 	"projects/internal/database/processes"
 	"projects/internal/database/stage"
+	"projects/internal/database/tags"
+	"projects/internal/database/tasks"
 )
 
 type Status string
@@ -32,14 +36,34 @@ func (s *Status) String() string {
 	return string(*s)
 }
 
-type milestoneInter interface {
+// Valid reports whether s is one of the enum_status values.
+func (s Status) Valid() bool {
+	switch s {
+	case NewStatus, Hold, Cancelled, InProgress, Completed:
+		return true
+	}
+	return false
+}
+
+type MilestoneInter interface {
 	CreateMany(Stages []MilestoneEntity) ([]MilestoneEntity, error)
 	Update(shedules MilestoneEntity) (MilestoneEntity, error)
 	GetByProjectID(projectID int64) []MilestoneEntity
 	GetByStageID(stageID int64) []MilestoneEntity
+	GetByProjectIDs(projectIDs []int64) []MilestoneEntity
 	GetMilestoneByID(id int64) MilestoneEntity
+	Find(filter Filter) ([]MilestoneEntity, error)
+	UpdateColumns(milestoneID int64, updateColumns map[string]interface{}) error
 	GetByActionPlan(actionPlanID int64) []MilestoneEntity
 	DeleteByID(milestoneID int64) error
+	Move(milestoneID, stageID int64) (MilestoneEntity, error)
+	ChangeStatus(milestoneID int64, to Status, userID, comment string) (MilestoneEntity, error)
+	GetStatusHistory(milestoneID int64) ([]StatusHistoryEntity, error)
+	SetTaskCounts(milestoneID int64, done, total int) error
+	SetRequireChecklist(milestoneID int64, require bool) error
+	GetOpen() []MilestoneEntity
+	GetOverdue(projectID int64) []MilestoneEntity
+	MarkOverdue(ids []int64) ([]MilestoneEntity, error)
 }
 
 type MilestoneEntity struct {
@@ -56,6 +80,16 @@ type MilestoneEntity struct {
 	Hidden       bool   `gorm:"column:hidden;default:false"`
 	Title        string `gorm:"column:title"`
 	AssignID     string `gorm:"column:assign_id"`
+	ActualStart  int64  `gorm:"column:actual_start"`
+	ActualFinish int64  `gorm:"column:actual_finish"`
+	Weight       int    `gorm:"column:weight;default:1"`
+	TasksDone    int    `gorm:"column:tasks_done"`
+	TasksTotal   int    `gorm:"column:tasks_total"`
+	Overdue      bool   `gorm:"column:overdue;default:false"`
+	// CompletionProposed is set while all tasks are resolved but the milestone isn't completed
+	CompletionProposed bool `gorm:"column:completion_proposed;default:false"`
+
+	RequireChecklist bool `gorm:"column:require_checklist;default:false"`
 
 	Process   processes.ProcessEntity
 	ProcessID int64 `gorm:"process_id"`
@@ -65,11 +99,20 @@ func (MilestoneEntity) TableName() string {
 	return "milestone"
 }
 
+type Filter struct {
+	ProjectID    int64
+	WorkspaceID  int64
+	ActionPlanID int64
+	StageID      int64
+	Status       Status
+	TagIDs       []int64
+}
+
 type milestone struct {
 	db *gorm.DB
 }
 
-func New(dbr *gorm.DB) milestoneInter {
+func New(dbr *gorm.DB) MilestoneInter {
 
 	return &milestone{db: dbr}
 }
@@ -102,6 +145,15 @@ func (s milestone) GetByProjectID(projectID int64) []MilestoneEntity {
 	return milestones
 }
 
+func (s milestone) GetByProjectIDs(projectIDs []int64) []MilestoneEntity {
+	var milestones []MilestoneEntity
+	if len(projectIDs) == 0 {
+		return milestones
+	}
+	s.db.Where("project_id IN ? and hidden = false", projectIDs).Find(&milestones)
+	return milestones
+}
+
 func (s milestone) GetByStageID(stageID int64) []MilestoneEntity {
 	var milestones []MilestoneEntity
 	s.db.Where("stage_id = ? and hidden = false", stageID).Order(`"order"`).Find(&milestones)
@@ -120,6 +172,49 @@ func (s milestone) GetMilestoneByID(id int64) MilestoneEntity {
 	return ms
 }
 
+// SetTaskCounts caches the resolved/total task counts used for progress rollups.
+func (s milestone) SetTaskCounts(milestoneID int64, done, total int) error {
+	return s.db.Model(MilestoneEntity{}).Where("milestone_id = ?", milestoneID).
+		Updates(map[string]interface{}{"tasks_done": done, "tasks_total": total}).Error
+}
+
+func (s milestone) SetRequireChecklist(milestoneID int64, require bool) error {
+	return s.db.Model(MilestoneEntity{}).Where("milestone_id = ?", milestoneID).
+		Update("require_checklist", require).Error
+}
+
+func (s milestone) Find(filter Filter) ([]MilestoneEntity, error) {
+	var miles []MilestoneEntity
+	query := s.db.Where("hidden = false")
+	if filter.ProjectID > 0 {
+		query = query.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.WorkspaceID > 0 {
+		query = query.Where("workspace_id = ?", filter.WorkspaceID)
+	}
+	if filter.ActionPlanID > 0 {
+		query = query.Where("action_plan_id = ?", filter.ActionPlanID)
+	}
+	if filter.StageID > 0 {
+		query = query.Where("stage_id = ?", filter.StageID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	query = tags.Filter(query, tags.Milestone, "milestone_id", filter.TagIDs)
+	if err := query.Order(`"order"`).Find(&miles).Error; err != nil {
+		return nil, err
+	}
+	return miles, nil
+}
+
+func (s milestone) UpdateColumns(milestoneID int64, updateColumns map[string]interface{}) error {
+	if len(updateColumns) == 0 {
+		return nil
+	}
+	return s.db.Model(MilestoneEntity{}).Where("milestone_id = ?", milestoneID).Updates(updateColumns).Error
+}
+
 func (s milestone) DeleteByID(milestoneID int64) error {
 	if err := s.db.Model(MilestoneEntity{}).Where("milestone_id = ?", milestoneID).Update("hidden", true).Error; err != nil {
 		return err
@@ -127,3 +222,84 @@ func (s milestone) DeleteByID(milestoneID int64) error {
 
 	return nil
 }
+
+// Move re-parents the milestone to another stage. The action plan, workspace and
+// project of the milestone, its epics and its tasks follow the target stage.
+func (s milestone) Move(milestoneID, stageID int64) (MilestoneEntity, error) {
+	var ms MilestoneEntity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var st stage.StageEntity
+		if err := tx.Where("stage_id = ? and hidden = false", stageID).First(&st).Error; err != nil {
+			return errors.New("target stage not found")
+		}
+
+		parent := map[string]interface{}{
+			"stage_id":       st.StageID,
+			"action_plan_id": st.ActionPlanID,
+			"workspace_id":   st.WorkspaceID,
+			"project_id":     st.ProjectID,
+		}
+		res := tx.Model(MilestoneEntity{}).Where("milestone_id = ? and hidden = false", milestoneID).Updates(parent)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("milestone not found")
+		}
+		if err := tx.Model(epics.EpicEntity{}).Where("milestone_id = ?", milestoneID).Updates(parent).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(tasks.TaskEntity{}).Where("milestone_id = ?", milestoneID).
+			Update("action_plan_id", st.ActionPlanID).Error; err != nil {
+			return err
+		}
+		return tx.Where("milestone_id = ?", milestoneID).First(&ms).Error
+	})
+	if err != nil {
+		return MilestoneEntity{}, err
+	}
+	return ms, nil
+}
+
+// GetOpen returns visible milestones that are neither completed nor cancelled.
+func (s milestone) GetOpen() []MilestoneEntity {
+	var miles []MilestoneEntity
+	s.db.Where("hidden = false and status NOT IN ?", []Status{Completed, Cancelled}).Find(&miles)
+	return miles
+}
+
+func (s milestone) GetOverdue(projectID int64) []MilestoneEntity {
+	var miles []MilestoneEntity
+	query := s.db.Where("hidden = false and overdue = true")
+	if projectID > 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+	query.Order("project_id, date_stop").Find(&miles)
+	return miles
+}
+
+// MarkOverdue flags the given milestones as overdue and clears the flag on all
+// others. It returns the milestones that were not flagged before.
+func (s milestone) MarkOverdue(ids []int64) ([]MilestoneEntity, error) {
+	var fresh []MilestoneEntity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			if err := tx.Where("milestone_id IN ? and overdue = false", ids).Find(&fresh).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(MilestoneEntity{}).Where("milestone_id IN ? and overdue = false", ids).
+				Update("overdue", true).Error; err != nil {
+				return err
+			}
+		}
+		query := tx.Model(MilestoneEntity{}).Where("overdue = true")
+		if len(ids) > 0 {
+			query = query.Where("milestone_id NOT IN ?", ids)
+		}
+		return query.Update("overdue", false).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
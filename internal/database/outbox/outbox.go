@@ -0,0 +1,216 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Status string
+
+const (
+	Pending Status = "pending"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+func (s *Status) Scan(value interface{}) error {
+	*s = Status(value.(string))
+	return nil
+}
+
+func (s Status) Value() (driver.Value, error) {
+	return string(s), nil
+}
+
+func (s *Status) String() string {
+	return string(*s)
+}
+
+// remote operations on the task service
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	// OpReparent changes only the milestone and epic of a task
+	OpReparent = "reparent"
+)
+
+type OutboxInter interface {
+	Add(entry *EntryEntity) error
+	AddBatch(entries []EntryEntity) error
+	Get(id int64) (EntryEntity, error)
+	GetDue(now int64, limit int) ([]EntryEntity, error)
+	PendingTaskIDs() (map[int64]bool, error)
+	HasPending(taskID int64) (bool, error)
+	HasNewer(id, taskID int64) (bool, error)
+	Claim(id int64, until int64) (bool, error)
+	Complete(id, taskID int64) error
+	Retry(id int64, nextAttempt int64, lastError string) error
+	Fail(id int64, lastError string) error
+	DeleteDone(before int64) (int64, error)
+}
+
+// EntryEntity is a pending change of the task service. It is written in the
+// same transaction as the local change and dispatched afterwards until it
+// succeeds, the idempotency key lets the task service drop repeated creates.
+// UserID and CompanyID attribute the change to its caller, the worker sends it
+// with the service token. Previous is the local task row before the change,
+// restored when the change is rejected.
+type EntryEntity struct {
+	ID             int64  `gorm:"column:id;primary_key;autoIncrement"`
+	Op             string `gorm:"column:op"`
+	TaskID         int64  `gorm:"column:task_id;index"`
+	Payload        string `gorm:"column:payload;type:text"`
+	UserID         string `gorm:"column:user_id"`
+	CompanyID      string `gorm:"column:company_id"`
+	Previous       string `gorm:"column:previous;type:text"`
+	IdempotencyKey string `gorm:"column:idempotency_key;uniqueIndex"`
+	Status         Status `gorm:"column:status;type:enum_outbox_status;default:'pending';index"`
+	Attempts       int    `gorm:"column:attempts;default:0"`
+	NextAttempt    int64  `gorm:"column:next_attempt;index"`
+	LockedUntil    int64  `gorm:"column:locked_until;default:0"`
+	LastError      string `gorm:"column:last_error"`
+	Created        int64  `gorm:"column:created"`
+	Updated        int64  `gorm:"column:updated"`
+}
+
+func (EntryEntity) TableName() string {
+	return "task_outbox"
+}
+
+func (e *EntryEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	e.Created = time.Now().Unix()
+	e.Updated = e.Created
+	if e.NextAttempt == 0 {
+		e.NextAttempt = e.Created
+	}
+	if e.IdempotencyKey == "" {
+		e.IdempotencyKey, err = newKey()
+	}
+	return
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type outbox struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) OutboxInter {
+	return &outbox{db: dbr}
+}
+
+func (o outbox) Add(entry *EntryEntity) error {
+	return o.db.Create(entry).Error
+}
+
+func (o outbox) AddBatch(entries []EntryEntity) error {
+	return o.db.Create(&entries).Error
+}
+
+func (o outbox) Get(id int64) (EntryEntity, error) {
+	var entry EntryEntity
+	err := o.db.Where("id = ?", id).First(&entry).Error
+	return entry, err
+}
+
+// first limits entries of a task to the oldest pending one, so changes of a
+// task reach the task service in the order they were made. Creates have no
+// task yet and are never held back.
+const first = `(task_id = 0 OR NOT EXISTS (SELECT 1 FROM task_outbox older
+	WHERE older.task_id = task_outbox.task_id AND older.status = 'pending' AND older.id < task_outbox.id))`
+
+// GetDue returns pending entries whose next attempt is due, oldest first, and
+// only the oldest pending entry of each task.
+func (o outbox) GetDue(now int64, limit int) ([]EntryEntity, error) {
+	var entries []EntryEntity
+	err := o.db.Where("status = ? AND next_attempt <= ? AND locked_until < ?", Pending, now, now).
+		Where(first).Order("id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// PendingTaskIDs returns the tasks with changes not sent yet.
+func (o outbox) PendingTaskIDs() (map[int64]bool, error) {
+	var ids []int64
+	if err := o.db.Model(EntryEntity{}).Where("status = ? AND task_id > 0", Pending).
+		Distinct().Pluck("task_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	pending := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		pending[id] = true
+	}
+	return pending, nil
+}
+
+// HasPending reports whether the task has changes not sent yet.
+func (o outbox) HasPending(taskID int64) (bool, error) {
+	var count int64
+	err := o.db.Model(EntryEntity{}).Where("status = ? AND task_id = ?", Pending, taskID).Count(&count).Error
+	return count > 0, err
+}
+
+// Claim locks a pending entry until the given time and reports whether this
+// caller got it, so the handler and the worker never send the same entry twice
+// at once. An entry waiting for an older one of its task is not claimed.
+func (o outbox) Claim(id int64, until int64) (bool, error) {
+	res := o.db.Model(EntryEntity{}).
+		Where("id = ? AND status = ? AND locked_until < ?", id, Pending, time.Now().Unix()).
+		Where(first).Update("locked_until", until)
+	return res.RowsAffected == 1, res.Error
+}
+
+// HasNewer reports whether the task got another change after the entry.
+func (o outbox) HasNewer(id, taskID int64) (bool, error) {
+	if taskID == 0 {
+		return false, nil
+	}
+	var count int64
+	err := o.db.Model(EntryEntity{}).Where("task_id = ? AND id > ?", taskID, id).Count(&count).Error
+	return count > 0, err
+}
+
+func (o outbox) Complete(id, taskID int64) error {
+	return o.db.Model(EntryEntity{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       Done,
+		"task_id":      taskID,
+		"locked_until": 0,
+		"last_error":   "",
+		"updated":      time.Now().Unix(),
+	}).Error
+}
+
+func (o outbox) Retry(id int64, nextAttempt int64, lastError string) error {
+	return o.db.Model(EntryEntity{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"next_attempt": nextAttempt,
+		"locked_until": 0,
+		"last_error":   lastError,
+		"updated":      time.Now().Unix(),
+	}).Error
+}
+
+func (o outbox) Fail(id int64, lastError string) error {
+	return o.db.Model(EntryEntity{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       Failed,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"locked_until": 0,
+		"last_error":   lastError,
+		"updated":      time.Now().Unix(),
+	}).Error
+}
+
+func (o outbox) DeleteDone(before int64) (int64, error) {
+	res := o.db.Where("status = ? AND updated < ?", Done, before).Delete(EntryEntity{})
+	return res.RowsAffected, res.Error
+}
@@ -1,19 +1,43 @@
 package processes
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
 )
 
+var (
+	ErrNotFound = errors.New("process not found")
+	ErrInactive = errors.New("process is not active")
+)
+
 type ProcessEntity struct {
-	ProcessID int64  `gorm:"column:process_id;primary_key;autoIncrement"`
-	Name      string `gorm:"column:name"`
+	ProcessID   int64  `gorm:"column:process_id;primary_key;autoIncrement"`
+	Name        string `gorm:"column:name"`
+	Description string `gorm:"column:description"`
+	Category    string `gorm:"column:category;index"`
+	OwnerTeam   string `gorm:"column:owner_team"`
+	Active      bool   `gorm:"column:active;default:true"`
+}
+
+// Filter selects processes of the catalog, zero fields are ignored.
+type Filter struct {
+	Category  string
+	OwnerTeam string
+	Active    *bool
 }
 
 type ProcessInter interface {
 	Create(proc *ProcessEntity) error
 	GetAll() ([]ProcessEntity, error)
+	GetByID(id int64) (ProcessEntity, error)
+	Find(filter Filter) ([]ProcessEntity, error)
 	Update(proc *ProcessEntity) error
 	Delete(id int64) error
+	Link(processID int64, milestoneIDs []int64) ([]int64, error)
+	Unlink(processID int64, milestoneIDs []int64) error
+	GetStandard(processID int64) ([]StandardEpicEntity, []StandardTaskEntity, error)
+	ReplaceStandard(processID int64, epics []StandardEpicEntity, tasks []StandardTaskEntity) error
 }
 
 type processes struct {
@@ -24,21 +48,51 @@ func New(db *gorm.DB) ProcessInter {
 	return &processes{db: db}
 }
 
+// catalogColumns are written as given, Active included although it defaults to true.
+var catalogColumns = []string{"name", "description", "category", "owner_team", "active"}
+
 func (p *processes) Create(proc *ProcessEntity) error {
-	return p.db.Create(proc).Error
+	return p.db.Select(catalogColumns).Create(proc).Error
 }
 
 func (p *processes) GetAll() ([]ProcessEntity, error) {
+	return p.Find(Filter{})
+}
+
+func (p *processes) GetByID(id int64) (ProcessEntity, error) {
+	var proc ProcessEntity
+	if err := p.db.Where("process_id = ?", id).First(&proc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return proc, ErrNotFound
+		}
+		return proc, err
+	}
+
+	return proc, nil
+}
+
+func (p *processes) Find(filter Filter) ([]ProcessEntity, error) {
 	var proc []ProcessEntity
-	if err := p.db.Find(&proc).Error; err != nil {
+	query := p.db.Order("process_id")
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.OwnerTeam != "" {
+		query = query.Where("owner_team = ?", filter.OwnerTeam)
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if err := query.Find(&proc).Error; err != nil {
 		return nil, err
 	}
 
 	return proc, nil
 }
 
+// Update writes all catalog fields, callers merge partial changes first.
 func (p *processes) Update(proc *ProcessEntity) error {
-	return p.db.Updates(proc).Error
+	return p.db.Model(proc).Select(catalogColumns).Updates(proc).Error
 }
 
 func (p *processes) Delete(id int64) error {
@@ -58,6 +112,14 @@ func (p *processes) Delete(id int64) error {
 		tx.Rollback()
 		return err
 	}
+	if err := tx.Where("process_id = ?", id).Delete(StandardTaskEntity{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("process_id = ?", id).Delete(StandardEpicEntity{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
 	if err := tx.Where("process_id = ?", id).Delete(ProcessEntity{}).Error; err != nil {
 		tx.Rollback()
 		return err
@@ -65,3 +127,42 @@ func (p *processes) Delete(id int64) error {
 
 	return tx.Commit().Error
 }
+
+// Link assigns the process to the milestones and returns the ids of the
+// milestones that weren't linked to it before. Only active processes can be
+// linked.
+func (p *processes) Link(processID int64, milestoneIDs []int64) ([]int64, error) {
+	var linked []int64
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		proc, err := New(tx).GetByID(processID)
+		if err != nil {
+			return err
+		}
+		if !proc.Active {
+			return ErrInactive
+		}
+		if err := tx.Table("milestone").
+			Where("milestone_id IN ? AND process_id IS DISTINCT FROM ?", milestoneIDs, processID).
+			Pluck("milestone_id", &linked).Error; err != nil {
+			return err
+		}
+		if len(linked) == 0 {
+			return nil
+		}
+		return tx.Table("milestone").
+			Where("milestone_id IN ?", linked).
+			Updates(map[string]interface{}{"process_id": processID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return linked, nil
+}
+
+// Unlink removes the process from those of the milestones it is assigned to.
+func (p *processes) Unlink(processID int64, milestoneIDs []int64) error {
+	return p.db.Table("milestone").
+		Where("milestone_id IN ? AND process_id = ?", milestoneIDs, processID).
+		Updates(map[string]interface{}{"process_id": nil}).Error
+}
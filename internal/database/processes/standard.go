@@ -0,0 +1,86 @@
+package processes
+
+import "gorm.io/gorm"
+
+// StandardEpicEntity is an epic generated in every milestone linked to the process.
+type StandardEpicEntity struct {
+	ID          int64                `gorm:"column:id;primary_key;autoIncrement"`
+	ProcessID   int64                `gorm:"column:process_id;index"`
+	Title       string               `gorm:"column:title"`
+	Description string               `gorm:"column:description"`
+	Order       int                  `gorm:"column:order"`
+	Tasks       []StandardTaskEntity `gorm:"foreignKey:StandardEpicID"`
+}
+
+func (StandardEpicEntity) TableName() string {
+	return "process_standard_epic"
+}
+
+// StandardTaskEntity is a generated task, StandardEpicID = 0 puts it straight
+// into the milestone.
+type StandardTaskEntity struct {
+	ID             int64  `gorm:"column:id;primary_key;autoIncrement"`
+	ProcessID      int64  `gorm:"column:process_id;index"`
+	StandardEpicID int64  `gorm:"column:standard_epic_id;index"`
+	Title          string `gorm:"column:title"`
+	Description    string `gorm:"column:description"`
+	Order          int    `gorm:"column:order"`
+}
+
+func (StandardTaskEntity) TableName() string {
+	return "process_standard_task"
+}
+
+// GetStandard returns the standard epics with their tasks and the tasks
+// without an epic, both ordered.
+func (p *processes) GetStandard(processID int64) ([]StandardEpicEntity, []StandardTaskEntity, error) {
+	var epics []StandardEpicEntity
+	if err := p.db.Where("process_id = ?", processID).
+		Preload("Tasks", func(db *gorm.DB) *gorm.DB { return db.Order(`"order", id`) }).
+		Order(`"order", id`).Find(&epics).Error; err != nil {
+		return nil, nil, err
+	}
+	var tasks []StandardTaskEntity
+	if err := p.db.Where("process_id = ? AND standard_epic_id = 0", processID).
+		Order(`"order", id`).Find(&tasks).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return epics, tasks, nil
+}
+
+// ReplaceStandard swaps the standard set of the process, epic tasks are
+// created along with their epics.
+func (p *processes) ReplaceStandard(processID int64, epics []StandardEpicEntity, tasks []StandardTaskEntity) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := New(tx).GetByID(processID); err != nil {
+			return err
+		}
+		if err := tx.Where("process_id = ?", processID).Delete(StandardTaskEntity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("process_id = ?", processID).Delete(StandardEpicEntity{}).Error; err != nil {
+			return err
+		}
+		for i := range epics {
+			epics[i].ID = 0
+			epics[i].ProcessID = processID
+			for j := range epics[i].Tasks {
+				epics[i].Tasks[j].ID = 0
+				epics[i].Tasks[j].ProcessID = processID
+			}
+			if err := tx.Create(&epics[i]).Error; err != nil {
+				return err
+			}
+		}
+		for i := range tasks {
+			tasks[i].ID = 0
+			tasks[i].ProcessID = processID
+			tasks[i].StandardEpicID = 0
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+		return tx.Create(&tasks).Error
+	})
+}
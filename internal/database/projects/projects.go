@@ -5,6 +5,8 @@ import (
 
 	"database/sql/driver"
 	"gorm.io/gorm"
+
+	"projects/internal/database/tags"
 )
 
 type Stage string
@@ -145,6 +147,7 @@ type ProjectFilter struct {
 	Cluster *string
 	Type    *string
 	Stage   *string
+	TagIDs  []int64
 }
 
 func prepareQuery(filter ProjectFilter, dbr *gorm.DB) *gorm.DB {
@@ -158,7 +161,7 @@ func prepareQuery(filter ProjectFilter, dbr *gorm.DB) *gorm.DB {
 	if filter.Stage != nil {
 		query = query.Where("stage = ?", *filter.Stage)
 	}
-	return query
+	return tags.Filter(query, tags.Project, "project_id", filter.TagIDs)
 }
 
 func New(dbr *gorm.DB) ProjectsInter {
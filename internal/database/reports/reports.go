@@ -0,0 +1,123 @@
+package reports
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"projects/internal/database/milestone"
+)
+
+// Filter narrows the reports to projects of a cluster, region and type and
+// optionally to one process, zero fields are ignored.
+type Filter struct {
+	ProcessID int64
+	Cluster   string
+	Region    string
+	Type      string
+}
+
+// StatusCount is the number of milestones of a process in one status.
+type StatusCount struct {
+	ProcessID int64
+	Status    milestone.Status
+	Count     int
+	Overdue   int
+}
+
+// Cycle is a completed milestone with the time it entered in progress and the
+// time it was completed, both unix seconds.
+type Cycle struct {
+	ProcessID   int64
+	ProjectID   int64
+	MilestoneID int64
+	Started     int64
+	Finished    int64
+}
+
+type ReportInter interface {
+	StatusCounts(filter Filter) ([]StatusCount, error)
+	Cycles(filter Filter) ([]Cycle, error)
+	ProjectTitles(ids []int64) (map[int64]string, error)
+}
+
+type reports struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) ReportInter {
+	return &reports{db: db}
+}
+
+func (r *reports) StatusCounts(filter Filter) ([]StatusCount, error) {
+	var counts []StatusCount
+	err := r.milestones(filter).
+		Select("m.process_id, m.status, COUNT(*) AS count, COUNT(*) FILTER (WHERE m.overdue) AS overdue").
+		Group("m.process_id, m.status").Order("m.process_id").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// Cycles returns completed milestones with their cycle bounds taken from the
+// status history: the first move to in progress and the last completion.
+// Milestones completed without passing in progress start at actual_start.
+func (r *reports) Cycles(filter Filter) ([]Cycle, error) {
+	var cycles []Cycle
+	err := r.milestones(filter).
+		Joins("JOIN milestone_status_history h ON h.milestone_id = m.milestone_id").
+		Select(fmt.Sprintf(`m.process_id, m.project_id, m.milestone_id,
+			COALESCE(MIN(h.created) FILTER (WHERE h.to_status = '%s'), m.actual_start) AS started,
+			COALESCE(MAX(h.created) FILTER (WHERE h.to_status = '%s'), 0) AS finished`, milestone.InProgress, milestone.Completed)).
+		Where("m.status = ?", milestone.Completed).
+		Group("m.process_id, m.project_id, m.milestone_id, m.actual_start").
+		Scan(&cycles).Error
+	if err != nil {
+		return nil, err
+	}
+	measured := cycles[:0]
+	for _, c := range cycles {
+		if c.Started > 0 && c.Finished >= c.Started {
+			measured = append(measured, c)
+		}
+	}
+	return measured, nil
+}
+
+func (r *reports) ProjectTitles(ids []int64) (map[int64]string, error) {
+	var rows []struct {
+		ProjectID int64
+		Title     string
+	}
+	titles := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return titles, nil
+	}
+	if err := r.db.Table("projects").Select("project_id, title").Where("project_id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		titles[row.ProjectID] = row.Title
+	}
+	return titles, nil
+}
+
+// milestones selects visible milestones linked to a process, in visible
+// projects matching the filter.
+func (r *reports) milestones(filter Filter) *gorm.DB {
+	query := r.db.Table("milestone m").
+		Joins("JOIN projects p ON p.project_id = m.project_id").
+		Where("m.process_id IS NOT NULL AND m.hidden = false AND p.hidden = 0")
+	if filter.ProcessID > 0 {
+		query = query.Where("m.process_id = ?", filter.ProcessID)
+	}
+	if filter.Cluster != "" {
+		query = query.Where("p.cluster = ?", filter.Cluster)
+	}
+	if filter.Region != "" {
+		query = query.Where("p.region = ?", filter.Region)
+	}
+	if filter.Type != "" {
+		query = query.Where("p.type = ?", filter.Type)
+	}
+	return query
+}
@@ -11,7 +11,11 @@ type StageInter interface {
 	Update(stages StageEntity) (StageEntity, error)
 	GetByProjectID(projectID int64) []StageEntity
 	GetByActionPlan(actionPlanID int64) []StageEntity
+	GetByWorkspaceID(workspaceID int64) []StageEntity
 	DeleteStage(stageID int64) error
+	GetWithDeadline() []StageEntity
+	GetOverdue(projectID int64) []StageEntity
+	MarkOverdue(ids []int64) ([]StageEntity, error)
 }
 
 type StageEntity struct {
@@ -25,6 +29,7 @@ type StageEntity struct {
 	Hidden       bool   `gorm:"column:hidden;default:false"`
 	Order        int    `gorm:"column:order"`
 	Title        string `gorm:"column:title"`
+	Overdue      bool   `gorm:"column:overdue;default:false"`
 }
 
 func (StageEntity) TableName() string {
@@ -73,6 +78,54 @@ func (s stage) GetByActionPlan(actionPlanID int64) []StageEntity {
 	return stages
 }
 
+func (s stage) GetByWorkspaceID(workspaceID int64) []StageEntity {
+	var stages []StageEntity
+	s.db.Where("workspace_id = ? and hidden = false", workspaceID).Order(`action_plan_id, "order"`).Find(&stages)
+	return stages
+}
+
 func (s stage) DeleteStage(stageID int64) error {
 	return s.db.Where("stage_id = ?", stageID).Delete(StageEntity{}).Error
 }
+
+func (s stage) GetWithDeadline() []StageEntity {
+	var stages []StageEntity
+	s.db.Where("hidden = false and date_stop <> ''").Find(&stages)
+	return stages
+}
+
+func (s stage) GetOverdue(projectID int64) []StageEntity {
+	var stages []StageEntity
+	query := s.db.Where("hidden = false and overdue = true")
+	if projectID > 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+	query.Order("project_id, date_stop").Find(&stages)
+	return stages
+}
+
+// MarkOverdue flags the given stages as overdue and clears the flag on all
+// others. It returns the stages that were not flagged before.
+func (s stage) MarkOverdue(ids []int64) ([]StageEntity, error) {
+	var fresh []StageEntity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			if err := tx.Where("stage_id IN ? and overdue = false", ids).Find(&fresh).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(StageEntity{}).Where("stage_id IN ? and overdue = false", ids).
+				Update("overdue", true).Error; err != nil {
+				return err
+			}
+		}
+		query := tx.Model(StageEntity{}).Where("overdue = true")
+		if len(ids) > 0 {
+			query = query.Where("stage_id NOT IN ?", ids)
+		}
+		return query.Update("overdue", false).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
@@ -0,0 +1,172 @@
+package tags
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// entity types a tag can be linked to
+const (
+	Project   = "project"
+	Milestone = "milestone"
+	Epic      = "epic"
+)
+
+type TagsInter interface {
+	Create(tag *TagEntity) error
+	Get(id int64) (TagEntity, error)
+	GetByCompany(companyID string) ([]TagEntity, error)
+	Update(id int64, updateColumns map[string]interface{}) (TagEntity, error)
+	Delete(id int64) error
+
+	Link(tagID int64, entityType string, entityID int64) error
+	Unlink(tagID int64, entityType string, entityID int64) error
+	GetByEntity(companyID, entityType string, entityID int64) ([]TagEntity, error)
+	Usage(tagIDs []int64) (map[int64]map[string]int64, error)
+}
+
+type TagEntity struct {
+	TagID     int64  `gorm:"column:tag_id;primary_key;autoIncrement"`
+	CompanyID string `gorm:"column:company_id;uniqueIndex:idx_tag_company_name"`
+	Name      string `gorm:"column:name;uniqueIndex:idx_tag_company_name"`
+	Color     string `gorm:"column:color"`
+	Created   int64  `gorm:"column:created"`
+}
+
+func (TagEntity) TableName() string {
+	return "tag"
+}
+
+func (t *TagEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	t.Created = time.Now().Unix()
+	return
+}
+
+type TagLinkEntity struct {
+	TagID      int64  `gorm:"column:tag_id;primary_key;autoIncrement:false"`
+	EntityType string `gorm:"column:entity_type;primary_key"`
+	EntityID   int64  `gorm:"column:entity_id;primary_key;autoIncrement:false"`
+}
+
+func (TagLinkEntity) TableName() string {
+	return "tag_link"
+}
+
+// Filter narrows the query to rows of entityType carrying every given tag.
+// column is the primary key column of the filtered table.
+func Filter(query *gorm.DB, entityType, column string, tagIDs []int64) *gorm.DB {
+	if len(tagIDs) == 0 {
+		return query
+	}
+	return query.Where(column+` IN (SELECT entity_id FROM tag_link
+		WHERE entity_type = ? AND tag_id IN ? GROUP BY entity_id HAVING COUNT(DISTINCT tag_id) = ?)`,
+		entityType, tagIDs, len(uniq(tagIDs)))
+}
+
+func uniq(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+type tags struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) TagsInter {
+
+	return &tags{db: dbr}
+}
+
+func (t tags) Create(tag *TagEntity) error {
+	return t.db.Create(tag).Error
+}
+
+func (t tags) Get(id int64) (TagEntity, error) {
+	var tag TagEntity
+	if err := t.db.Where("tag_id = ?", id).First(&tag).Error; err != nil {
+		return TagEntity{}, err
+	}
+	return tag, nil
+}
+
+func (t tags) GetByCompany(companyID string) ([]TagEntity, error) {
+	var tagEntities []TagEntity
+	if err := t.db.Where("company_id = ?", companyID).Order("name").Find(&tagEntities).Error; err != nil {
+		return nil, err
+	}
+	return tagEntities, nil
+}
+
+func (t tags) Update(id int64, updateColumns map[string]interface{}) (TagEntity, error) {
+	if len(updateColumns) > 0 {
+		if err := t.db.Model(TagEntity{}).Where("tag_id = ?", id).Updates(updateColumns).Error; err != nil {
+			return TagEntity{}, err
+		}
+	}
+	return t.Get(id)
+}
+
+func (t tags) Delete(id int64) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", id).Delete(TagLinkEntity{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tag_id = ?", id).Delete(TagEntity{}).Error
+	})
+}
+
+func (t tags) Link(tagID int64, entityType string, entityID int64) error {
+	link := TagLinkEntity{TagID: tagID, EntityType: entityType, EntityID: entityID}
+	return t.db.Where(link).FirstOrCreate(&link).Error
+}
+
+func (t tags) Unlink(tagID int64, entityType string, entityID int64) error {
+	return t.db.Where("tag_id = ? and entity_type = ? and entity_id = ?", tagID, entityType, entityID).
+		Delete(TagLinkEntity{}).Error
+}
+
+// GetByEntity returns the tags of the company linked to the entity.
+func (t tags) GetByEntity(companyID, entityType string, entityID int64) ([]TagEntity, error) {
+	var tagEntities []TagEntity
+	if err := t.db.Joins("JOIN tag_link tl ON tl.tag_id = tag.tag_id").
+		Where("tag.company_id = ? and tl.entity_type = ? and tl.entity_id = ?", companyID, entityType, entityID).
+		Order("tag.name").Find(&tagEntities).Error; err != nil {
+		return nil, err
+	}
+	return tagEntities, nil
+}
+
+// visibleLinks joins the linked rows to tag_link tl, hidden ones match none.
+const visibleLinks = `LEFT JOIN projects p ON tl.entity_type = 'project' AND p.project_id = tl.entity_id AND p.hidden = 0
+	LEFT JOIN milestone m ON tl.entity_type = 'milestone' AND m.milestone_id = tl.entity_id AND m.hidden = false
+	LEFT JOIN epic_entities e ON tl.entity_type = 'epic' AND e.id = tl.entity_id AND e.hidden = false`
+
+// Usage counts the links of every tag to visible entities per entity type.
+func (t tags) Usage(tagIDs []int64) (map[int64]map[string]int64, error) {
+	usage := make(map[int64]map[string]int64)
+	if len(tagIDs) == 0 {
+		return usage, nil
+	}
+	var rows []struct {
+		TagID      int64
+		EntityType string
+		Count      int64
+	}
+	if err := t.db.Table("tag_link tl").Select("tl.tag_id, tl.entity_type, COUNT(*) AS count").Joins(visibleLinks).
+		Where("tl.tag_id IN ?", tagIDs).
+		Where("p.project_id IS NOT NULL OR m.milestone_id IS NOT NULL OR e.id IS NOT NULL").
+		Group("tl.tag_id, tl.entity_type").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if usage[r.TagID] == nil {
+			usage[r.TagID] = make(map[string]int64)
+		}
+		usage[r.TagID][r.EntityType] = r.Count
+	}
+	return usage, nil
+}
@@ -8,4 +8,6 @@ type TaskEntity struct {
 	EpicID       int64            `gorm:"column:epic_id"`
 	Epic         epics.EpicEntity `gorm:"-"`
 	ActionPlanID int64            `gorm:"column:action_plan_id"`
+	Done         bool             `gorm:"column:done;default:false"`
+	Started      bool             `gorm:"column:started;default:false"`
 }
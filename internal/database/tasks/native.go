@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NativeTaskEntity is a full task stored by the native task backend, used
+// instead of the remote task service when Task.Backend is "native".
+// IdempotencyKey is the key of the create, nil when there was none.
+type NativeTaskEntity struct {
+	ID             int64   `gorm:"column:id;primary_key;autoIncrement"`
+	IdempotencyKey *string `gorm:"column:idempotency_key;uniqueIndex"`
+	MilestoneID    int64   `gorm:"column:milestone_id;index"`
+	EpicID         int64   `gorm:"column:epic_id;index"`
+	ProjectID      string  `gorm:"column:project_id"`
+	CompanyID      string  `gorm:"column:company_id"`
+	GroupID        string  `gorm:"column:group_id"`
+	CreatorID      string  `gorm:"column:creator_id"`
+	ReporterID     string  `gorm:"column:reporter_id"`
+	AssigneeID     string  `gorm:"column:assignee_id;index"`
+	Title          string  `gorm:"column:title"`
+	Description    string  `gorm:"column:description"`
+	Priority       string  `gorm:"column:priority"`
+	Status         string  `gorm:"column:status;default:'new'"`
+	StartTime      string  `gorm:"column:start_time"`
+	EndTime        string  `gorm:"column:end_time"`
+	ResolvedTime   string  `gorm:"column:resolved_time"`
+	Created        int64   `gorm:"column:created"`
+	Updated        int64   `gorm:"column:updated"`
+}
+
+func (NativeTaskEntity) TableName() string {
+	return "task"
+}
+
+func (t *NativeTaskEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	t.Created = time.Now().Unix()
+	t.Updated = t.Created
+	return
+}
+
+type NativeInter interface {
+	Create(task *NativeTaskEntity) error
+	CreateOnce(task *NativeTaskEntity) error
+	GetByIDs(ids []int64) ([]NativeTaskEntity, error)
+	GetByMilestoneIDs(milestoneIDs []int64) ([]NativeTaskEntity, error)
+	Update(id int64, updateColumns map[string]interface{}) (NativeTaskEntity, error)
+	Delete(id int64) (bool, error)
+}
+
+func NewNative(db *gorm.DB) NativeInter {
+	return &native{db: db}
+}
+
+type native struct {
+	db *gorm.DB
+}
+
+func (n *native) Create(task *NativeTaskEntity) error {
+	return n.db.Create(task).Error
+}
+
+// CreateOnce creates the task unless one with its idempotency key exists,
+// task is then set to the existing one.
+func (n *native) CreateOnce(task *NativeTaskEntity) error {
+	if task.IdempotencyKey == nil {
+		return n.Create(task)
+	}
+	res := n.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "idempotency_key"}}, DoNothing: true}).Create(task)
+	if res.Error != nil || res.RowsAffected == 1 {
+		return res.Error
+	}
+	key := *task.IdempotencyKey
+	*task = NativeTaskEntity{}
+	return n.db.Where("idempotency_key = ?", key).First(task).Error
+}
+
+func (n *native) GetByIDs(ids []int64) ([]NativeTaskEntity, error) {
+	var res []NativeTaskEntity
+	if err := n.db.Where("id IN ?", ids).Order("id").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (n *native) GetByMilestoneIDs(milestoneIDs []int64) ([]NativeTaskEntity, error) {
+	var res []NativeTaskEntity
+	if err := n.db.Where("milestone_id IN ?", milestoneIDs).Order("id").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (n *native) Update(id int64, updateColumns map[string]interface{}) (NativeTaskEntity, error) {
+	var task NativeTaskEntity
+	updateColumns["updated"] = time.Now().Unix()
+	if err := n.db.Model(NativeTaskEntity{}).Where("id = ?", id).Updates(updateColumns).Error; err != nil {
+		return task, err
+	}
+	err := n.db.Where("id = ?", id).First(&task).Error
+	return task, err
+}
+
+// Delete reports false when there was no such task.
+func (n *native) Delete(id int64) (bool, error) {
+	res := n.db.Where("id = ?", id).Delete(NativeTaskEntity{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -1,6 +1,11 @@
 package tasks
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"projects/internal/database/epics"
+)
 
 type Task interface {
 	CreateTask(taskEntity TaskEntity) (*TaskEntity, error)
@@ -10,12 +15,40 @@ type Task interface {
 	GetTaskByActionPlanID(id int64) ([]TaskEntity, error)
 	UpdateTask(entity *TaskEntity) error
 	DeleteTask(id int64) error
+	GetTaskIDsByEpicID(epicID int64) ([]int64, error)
+	MoveEpicTasks(fromEpicID int64, to epics.EpicEntity) error
+	DetachEpicTasks(epicID int64) error
+	DeleteByEpicID(epicID int64) error
+	Upsert(entity TaskEntity) error
+	SetDone(ids []int64, done bool) error
+	SetStarted(ids []int64, started bool) error
+	GetPage(afterID int64, limit int) ([]TaskEntity, error)
+	Find(filter Filter) ([]TaskEntity, error)
+	FindPage(filter Filter, desc bool, offset, limit int) ([]TaskEntity, int64, error)
+	GetByIDs(ids []int64) ([]TaskEntity, error)
+	GetByEpicIDs(epicIDs []int64) ([]TaskEntity, error)
+	CountByMilestoneID(milestoneID int64) (done, total int, err error)
+	CountStarted(milestoneID int64) (int, error)
+	GetOpenByMilestoneID(milestoneID int64) ([]TaskEntity, error)
 }
 
 func New(db *gorm.DB) Task {
 	return &task{db: db}
 }
 
+// Filter selects tasks by their place in the project tree, zero fields are ignored.
+type Filter struct {
+	ProjectID    int64
+	ActionPlanID int64
+	StageID      int64
+	MilestoneID  int64
+	EpicID       int64
+}
+
+func (f Filter) Empty() bool {
+	return f == Filter{}
+}
+
 type task struct {
 	db *gorm.DB
 }
@@ -76,9 +109,165 @@ func (t *task) UpdateTask(entity *TaskEntity) error {
 		query["action_plan_id"] = entity.ActionPlanID
 	}
 
-	return t.db.Model(TaskEntity{}).Updates(query).Error
+	return t.db.Model(TaskEntity{}).Where("id = ?", entity.ID).Updates(query).Error
 }
 
 func (t *task) DeleteTask(id int64) error {
 	return t.db.Where("id = ?", id).Delete(TaskEntity{}).Error
 }
+
+func (t *task) GetTaskIDsByEpicID(epicID int64) ([]int64, error) {
+	var ids []int64
+	if err := t.db.Model(TaskEntity{}).Where("epic_id = ?", epicID).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// MoveEpicTasks re-parents all tasks of an epic to another epic and its milestone.
+func (t *task) MoveEpicTasks(fromEpicID int64, to epics.EpicEntity) error {
+	return t.db.Model(TaskEntity{}).Where("epic_id = ?", fromEpicID).Updates(map[string]interface{}{
+		"epic_id":        to.ID,
+		"milestone_id":   to.MilestoneID,
+		"action_plan_id": to.ActionPlanID,
+	}).Error
+}
+
+// DetachEpicTasks keeps the tasks under their milestone without an epic.
+func (t *task) DetachEpicTasks(epicID int64) error {
+	return t.db.Model(TaskEntity{}).Where("epic_id = ?", epicID).Update("epic_id", 0).Error
+}
+
+func (t *task) DeleteByEpicID(epicID int64) error {
+	return t.db.Where("epic_id = ?", epicID).Delete(TaskEntity{}).Error
+}
+
+// Upsert writes the full mapping of a task, zero epic_id included.
+func (t *task) Upsert(entity TaskEntity) error {
+	return t.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"milestone_id", "epic_id", "action_plan_id", "done", "started"}),
+	}).Create(&entity).Error
+}
+
+// SetDone stores the resolved flag mirrored from the task service.
+func (t *task) SetDone(ids []int64, done bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return t.db.Model(TaskEntity{}).Where("id IN ?", ids).Update("done", done).Error
+}
+
+// SetStarted stores the started flag mirrored from the task service.
+func (t *task) SetStarted(ids []int64, started bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return t.db.Model(TaskEntity{}).Where("id IN ?", ids).Update("started", started).Error
+}
+
+func (t *task) CountStarted(milestoneID int64) (int, error) {
+	var started int64
+	err := t.db.Model(TaskEntity{}).Where("milestone_id = ? AND (started OR done)", milestoneID).Count(&started).Error
+	return int(started), err
+}
+
+// GetOpenByMilestoneID returns the unresolved tasks of a milestone.
+func (t *task) GetOpenByMilestoneID(milestoneID int64) ([]TaskEntity, error) {
+	var taskEntity []TaskEntity
+	if err := t.db.Where("milestone_id = ? AND NOT done", milestoneID).Order("id").Find(&taskEntity).Error; err != nil {
+		return nil, err
+	}
+
+	return taskEntity, nil
+}
+
+func (t *task) CountByMilestoneID(milestoneID int64) (done, total int, err error) {
+	var counts struct {
+		Done  int
+		Total int
+	}
+	err = t.db.Model(TaskEntity{}).Select("COUNT(*) FILTER (WHERE done) AS done, COUNT(*) AS total").
+		Where("milestone_id = ?", milestoneID).Scan(&counts).Error
+	return counts.Done, counts.Total, err
+}
+
+// GetPage returns up to limit tasks with id greater than afterID, ordered by id.
+func (t *task) GetPage(afterID int64, limit int) ([]TaskEntity, error) {
+	var taskEntity []TaskEntity
+	if err := t.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&taskEntity).Error; err != nil {
+		return nil, err
+	}
+	return taskEntity, nil
+}
+
+// Find returns the tasks of visible milestones matching the filter, ordered by id.
+func (t *task) Find(filter Filter) ([]TaskEntity, error) {
+	var taskEntity []TaskEntity
+	if err := t.scoped(filter).Select("task_entities.*").Order("task_entities.id").Find(&taskEntity).Error; err != nil {
+		return nil, err
+	}
+	return taskEntity, nil
+}
+
+// FindPage returns one page of Find ordered by id and the number of all
+// matching tasks.
+func (t *task) FindPage(filter Filter, desc bool, offset, limit int) ([]TaskEntity, int64, error) {
+	var total int64
+	if err := t.scoped(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order := "task_entities.id"
+	if desc {
+		order += " DESC"
+	}
+	var taskEntity []TaskEntity
+	if err := t.scoped(filter).Select("task_entities.*").Order(order).Offset(offset).Limit(limit).Find(&taskEntity).Error; err != nil {
+		return nil, 0, err
+	}
+	return taskEntity, total, nil
+}
+
+func (t *task) scoped(filter Filter) *gorm.DB {
+	query := t.db.Model(TaskEntity{}).
+		Joins("JOIN milestone ON milestone.milestone_id = task_entities.milestone_id").
+		Where("milestone.hidden = false")
+	if filter.ProjectID > 0 {
+		query = query.Where("milestone.project_id = ?", filter.ProjectID)
+	}
+	if filter.ActionPlanID > 0 {
+		query = query.Where("task_entities.action_plan_id = ?", filter.ActionPlanID)
+	}
+	if filter.StageID > 0 {
+		query = query.Where("milestone.stage_id = ?", filter.StageID)
+	}
+	if filter.MilestoneID > 0 {
+		query = query.Where("task_entities.milestone_id = ?", filter.MilestoneID)
+	}
+	if filter.EpicID > 0 {
+		query = query.Where("task_entities.epic_id = ?", filter.EpicID)
+	}
+	return query
+}
+
+func (t *task) GetByEpicIDs(epicIDs []int64) ([]TaskEntity, error) {
+	var taskEntity []TaskEntity
+	if len(epicIDs) == 0 {
+		return taskEntity, nil
+	}
+	if err := t.db.Where("epic_id IN ?", epicIDs).Find(&taskEntity).Error; err != nil {
+		return nil, err
+	}
+	return taskEntity, nil
+}
+
+func (t *task) GetByIDs(ids []int64) ([]TaskEntity, error) {
+	var taskEntity []TaskEntity
+	if len(ids) == 0 {
+		return taskEntity, nil
+	}
+	if err := t.db.Where("id IN ?", ids).Find(&taskEntity).Error; err != nil {
+		return nil, err
+	}
+	return taskEntity, nil
+}
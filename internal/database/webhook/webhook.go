@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookInter interface {
+	Register(eventID, eventType string) (bool, error)
+	Advance(taskID, at int64, deleted bool) (bool, error)
+	DeleteBefore(created int64) (int64, error)
+}
+
+// EventEntity remembers processed webhook deliveries, so a replayed event ID
+// is acknowledged without being applied again.
+type EventEntity struct {
+	EventID string `gorm:"column:event_id;primary_key"`
+	Type    string `gorm:"column:type"`
+	Created int64  `gorm:"column:created;index"`
+}
+
+func (EventEntity) TableName() string {
+	return "webhook_event"
+}
+
+func (e *EventEntity) BeforeCreate(_ *gorm.DB) (err error) {
+	e.Created = time.Now().Unix()
+	return
+}
+
+// TaskStateEntity is the time of the last event applied to a task, in unix
+// milliseconds. Deleted tasks keep their row as a tombstone.
+type TaskStateEntity struct {
+	TaskID    int64 `gorm:"column:task_id;primary_key;autoIncrement:false"`
+	LastEvent int64 `gorm:"column:last_event"`
+	Deleted   bool  `gorm:"column:deleted"`
+}
+
+func (TaskStateEntity) TableName() string {
+	return "webhook_task_state"
+}
+
+type webhook struct {
+	db *gorm.DB
+}
+
+func New(dbr *gorm.DB) WebhookInter {
+	return &webhook{db: dbr}
+}
+
+// Register records the event and reports false when it was seen before.
+func (w webhook) Register(eventID, eventType string) (bool, error) {
+	res := w.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&EventEntity{EventID: eventID, Type: eventType})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// Advance moves the task to the event and reports false when the event is
+// older than the last one applied or the task is deleted already.
+func (w webhook) Advance(taskID, at int64, deleted bool) (bool, error) {
+	res := w.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_event", "deleted"}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL: "NOT webhook_task_state.deleted AND webhook_task_state.last_event <= excluded.last_event",
+		}}},
+	}).Create(&TaskStateEntity{TaskID: taskID, LastEvent: at, Deleted: deleted})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (w webhook) DeleteBefore(created int64) (int64, error) {
+	res := w.db.Where("created < ?", created).Delete(EventEntity{})
+	return res.RowsAffected, res.Error
+}
@@ -2,8 +2,12 @@ package workspace
 
 import (
 	"database/sql/driver"
+	"errors"
+
+	"projects/internal/database/membership"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type WSType string
@@ -16,6 +20,13 @@ const (
 	BackOffice  WSType = "back office"
 )
 
+var (
+	ErrNotFound      = errors.New("workspace not found")
+	ErrBadType       = errors.New("unknown workspace type")
+	ErrNotEmpty      = errors.New("workspace still has action plans")
+	ErrLastWorkspace = errors.New("a project keeps at least one workspace")
+)
+
 func (c *WSType) Scan(value interface{}) error {
 	*c = WSType(value.(string))
 	return nil
@@ -25,8 +36,25 @@ func (c WSType) Value() (driver.Value, error) {
 	return string(c), nil
 }
 
+func (c *WSType) String() string {
+	return string(*c)
+}
+
+// ParseType validates a ws_type value.
+func ParseType(value string) (WSType, error) {
+	switch t := WSType(value); t {
+	case Development, Marketing, Legal, Support, BackOffice:
+		return t, nil
+	}
+	return "", ErrBadType
+}
+
 type WorkspaceInter interface {
 	Create(wE *WorkspaceEntity) error
+	Get(id int64) (WorkspaceEntity, error)
+	GetByProjectID(projectID int64) ([]WorkspaceEntity, error)
+	Update(id int64, updateColumns map[string]interface{}) (WorkspaceEntity, error)
+	Delete(id int64) error
 }
 
 type WorkspaceEntity struct {
@@ -55,3 +83,63 @@ func (w workspace) Create(wE *WorkspaceEntity) error {
 	}
 	return nil
 }
+
+func (w workspace) Get(id int64) (WorkspaceEntity, error) {
+	var ws WorkspaceEntity
+	if err := w.db.Where("workspace_id = ?", id).First(&ws).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ws, ErrNotFound
+		}
+		return ws, err
+	}
+	return ws, nil
+}
+
+func (w workspace) GetByProjectID(projectID int64) ([]WorkspaceEntity, error) {
+	var ws []WorkspaceEntity
+	if err := w.db.Where("project_id = ?", projectID).Order("workspace_id").Find(&ws).Error; err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (w workspace) Update(id int64, updateColumns map[string]interface{}) (WorkspaceEntity, error) {
+	if len(updateColumns) > 0 {
+		res := w.db.Model(WorkspaceEntity{}).Where("workspace_id = ?", id).Updates(updateColumns)
+		if res.Error != nil {
+			return WorkspaceEntity{}, res.Error
+		}
+	}
+	return w.Get(id)
+}
+
+// Delete removes an empty workspace and its members, the last workspace of a
+// project stays.
+func (w workspace) Delete(id int64) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		ws, err := New(tx).Get(id)
+		if err != nil {
+			return err
+		}
+		var plans int64
+		if err := tx.Table("action_plan").Where("workspace_id = ?", id).Count(&plans).Error; err != nil {
+			return err
+		}
+		if plans > 0 {
+			return ErrNotEmpty
+		}
+		// lock the project's workspaces, concurrent deletes must not remove the last one
+		var siblings []int64
+		if err := tx.Model(WorkspaceEntity{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("project_id = ?", ws.ProjectID).Pluck("workspace_id", &siblings).Error; err != nil {
+			return err
+		}
+		if len(siblings) <= 1 {
+			return ErrLastWorkspace
+		}
+		if err := tx.Where("workspace_id = ?", id).Delete(membership.MemberEntity{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("workspace_id = ?", id).Delete(WorkspaceEntity{}).Error
+	})
+}
@@ -0,0 +1,410 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+	"projects/internal/progress"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
+)
+
+const (
+	lockFor            = time.Minute
+	firstRetry         = 30 * time.Second
+	maxRetry           = time.Hour
+	defaultMaxAttempts = 10
+)
+
+// ErrPending means the change is stored and will be sent to the task service
+// by the outbox worker.
+var ErrPending = errors.New("task change is queued")
+
+// Dispatcher sends task_outbox entries to the task service. Outages are
+// retried with backoff until maxAttempts, rejected changes are marked failed.
+// Milestones whose tasks changed are published as MilestoneTasksChanged once
+// the local side is stored.
+type Dispatcher struct {
+	db          *gorm.DB
+	client      taskclient.Client
+	bus         events.Bus
+	log         *logrus.Logger
+	maxAttempts int
+}
+
+func New(db *gorm.DB, client taskclient.Client, bus events.Bus, log *logrus.Logger, maxAttempts int) Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return Dispatcher{db: db, client: client, bus: bus, log: log, maxAttempts: maxAttempts}
+}
+
+// Dispatch sends the entry once. A temporary failure returns an error wrapping
+// ErrPending, as does an entry another dispatcher is sending right now or one
+// waiting for an older change of its task.
+func (d Dispatcher) Dispatch(ctx context.Context, entry outbox.EntryEntity) (models.Task, error) {
+	claimed, err := outbox.New(d.db).Claim(entry.ID, time.Now().Add(lockFor).Unix())
+	if err != nil {
+		return models.Task{}, err
+	}
+	if !claimed {
+		return models.Task{}, ErrPending
+	}
+
+	task, req, err := d.remote(ctx, entry)
+	changed := make(map[int64]bool)
+	if err == nil {
+		err = d.db.Transaction(func(tx *gorm.DB) error {
+			if err := d.apply(tx, entry, req, task, make(map[int64]milestone.MilestoneEntity), changed); err != nil {
+				return err
+			}
+			return recount(tx, changed)
+		})
+		if err != nil {
+			err = d.applyFailed(entry, err)
+		}
+	}
+	if err != nil {
+		return task, d.failed(entry, err)
+	}
+	d.publish(changed)
+	return withLinks(entry, req, task), nil
+}
+
+// Outcome is the result of one entry of DispatchBatch.
+type Outcome struct {
+	Entry outbox.EntryEntity
+	Task  models.Task
+	Err   error
+}
+
+// DispatchBatch sends the entries with up to concurrency calls in flight and
+// stores all local results in one transaction.
+func (d Dispatcher) DispatchBatch(ctx context.Context, entries []outbox.EntryEntity, concurrency int) []Outcome {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	outcomes := make([]Outcome, len(entries))
+	reqs := make([]models.TaskReq, len(entries))
+	repo := outbox.New(d.db)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		outcomes[i].Entry = entry
+		claimed, err := repo.Claim(entry.ID, time.Now().Add(lockFor).Unix())
+		if err != nil || !claimed {
+			if err == nil {
+				err = ErrPending
+			}
+			outcomes[i].Err = err
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, entry outbox.EntryEntity) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i].Task, reqs[i], outcomes[i].Err = d.remote(ctx, entry)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	changed := make(map[int64]bool)
+	applyErr := d.db.Transaction(func(tx *gorm.DB) error {
+		miles := make(map[int64]milestone.MilestoneEntity)
+		for i, o := range outcomes {
+			if o.Err != nil {
+				continue
+			}
+			if err := d.apply(tx, o.Entry, reqs[i], o.Task, miles, changed); err != nil {
+				return err
+			}
+		}
+		return recount(tx, changed)
+	})
+	if applyErr == nil {
+		d.publish(changed)
+	}
+	for i, o := range outcomes {
+		switch {
+		case errors.Is(o.Err, ErrPending):
+		case o.Err != nil:
+			outcomes[i].Err = d.failed(o.Entry, o.Err)
+		case applyErr != nil:
+			if err := d.applyFailed(o.Entry, applyErr); err != nil {
+				outcomes[i].Err = d.failed(o.Entry, err)
+				continue
+			}
+			outcomes[i].Task = withLinks(o.Entry, reqs[i], o.Task)
+		default:
+			outcomes[i].Task = withLinks(o.Entry, reqs[i], o.Task)
+		}
+	}
+	return outcomes
+}
+
+// failed records a failed attempt: outages are retried with backoff until
+// maxAttempts, anything else marks the entry failed and reverts its local
+// change.
+func (d Dispatcher) failed(entry outbox.EntryEntity, err error) error {
+	repo := outbox.New(d.db)
+	if taskclient.Temporary(err) && entry.Attempts+1 < d.maxAttempts {
+		next := time.Now().Add(backoff(entry.Attempts)).Unix()
+		if rErr := repo.Retry(entry.ID, next, err.Error()); rErr != nil {
+			d.log.Warnln("outbox: can't schedule retry ", entry.ID, rErr)
+		}
+		return fmt.Errorf("%w: %v", ErrPending, err)
+	}
+	fErr := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := revert(tx, entry); err != nil {
+			return err
+		}
+		return outbox.New(tx).Fail(entry.ID, err.Error())
+	})
+	if fErr != nil {
+		d.log.Warnln("outbox: can't mark failed ", entry.ID, fErr)
+	}
+	d.log.Warnln("outbox: entry failed ", entry.ID, entry.Op, err)
+	return err
+}
+
+// Snapshot returns the local row of the task to store as Previous of an
+// update or delete entry, empty when there is none.
+func Snapshot(tx *gorm.DB, taskID int64) (string, error) {
+	current, err := tasks.New(tx).GetTaskByID(taskID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(current)
+	return string(raw), err
+}
+
+// Queue adds one entry per task in the transaction, before the local change,
+// so each entry keeps the row a rejection restores.
+func Queue(tx *gorm.DB, op string, taskIDs []int64, req models.TaskReq, caller events.Caller) ([]outbox.EntryEntity, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	current, err := tasks.New(tx).GetByIDs(taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]outbox.EntryEntity, 0, len(current))
+	for _, t := range current {
+		previous, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, outbox.EntryEntity{
+			Op:        op,
+			TaskID:    t.ID,
+			Payload:   string(payload),
+			UserID:    caller.UserID,
+			CompanyID: caller.Company,
+			Previous:  string(previous),
+		})
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return entries, outbox.New(tx).AddBatch(entries)
+}
+
+// revert restores the local row a rejected update or delete changed, unless
+// a later change of the task superseded it.
+func revert(tx *gorm.DB, entry outbox.EntryEntity) error {
+	if entry.Previous == "" {
+		return nil
+	}
+	newer, err := outbox.New(tx).HasNewer(entry.ID, entry.TaskID)
+	if err != nil || newer {
+		return err
+	}
+	var previous tasks.TaskEntity
+	if err := json.Unmarshal([]byte(entry.Previous), &previous); err != nil {
+		return err
+	}
+	return tasks.New(tx).Upsert(previous)
+}
+
+// applyFailed decides what a failed local write after a successful remote
+// call means. A create has to be sent again, the idempotency key makes the
+// task service return the same task. Updates and deletes are applied already
+// and are sent again harmlessly once their lock expires.
+func (d Dispatcher) applyFailed(entry outbox.EntryEntity, err error) error {
+	if entry.Op == outbox.OpCreate {
+		return &taskclient.Error{Op: "create", Kind: taskclient.ErrUnavailable, Err: err}
+	}
+	d.log.Warnln("outbox: can't mark done ", entry.ID, err)
+	return nil
+}
+
+// RunDue dispatches up to limit due entries and returns how many were sent.
+func (d Dispatcher) RunDue(ctx context.Context, limit int) (int, error) {
+	entries, err := outbox.New(d.db).GetDue(time.Now().Unix(), limit)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := d.Dispatch(ctx, e); err == nil {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// remote performs the change on the task service.
+func (d Dispatcher) remote(ctx context.Context, entry outbox.EntryEntity) (models.Task, models.TaskReq, error) {
+	var req models.TaskReq
+	if entry.Payload != "" {
+		if err := json.Unmarshal([]byte(entry.Payload), &req); err != nil {
+			return models.Task{}, req, err
+		}
+	}
+	ctx = taskclient.WithIdempotencyKey(ctx, entry.IdempotencyKey)
+
+	switch entry.Op {
+	case outbox.OpCreate:
+		created, err := d.client.Create(ctx, req)
+		return created, req, err
+	case outbox.OpUpdate:
+		updated, err := d.client.Update(ctx, entry.TaskID, req)
+		return updated, req, err
+	case outbox.OpDelete:
+		return models.Task{ID: entry.TaskID}, req, d.client.Delete(ctx, entry.TaskID)
+	case outbox.OpReparent:
+		task := models.Task{ID: entry.TaskID, MilestoneId: req.MilestoneID, EpicID: req.EpicID}
+		return task, req, d.client.Reparent(ctx, entry.TaskID, req.EpicID, req.MilestoneID)
+	}
+	return models.Task{}, req, fmt.Errorf("unknown outbox op %q", entry.Op)
+}
+
+// apply stores the local side of a sent entry: the task_entities row of a
+// created task, the done and started flags the task service returned and the
+// done mark. Milestones whose tasks changed are added to changed for the
+// caller to recount, miles caches milestone lookups of a batch.
+func (d Dispatcher) apply(tx *gorm.DB, entry outbox.EntryEntity, req models.TaskReq, task models.Task, miles map[int64]milestone.MilestoneEntity, changed map[int64]bool) error {
+	taskID := entry.TaskID
+	repo := tasks.New(tx)
+	switch entry.Op {
+	case outbox.OpCreate:
+		mile, ok := miles[req.MilestoneID]
+		if !ok {
+			mile = milestone.New(tx).GetMilestoneByID(req.MilestoneID)
+			miles[req.MilestoneID] = mile
+		}
+		if err := repo.Upsert(tasks.TaskEntity{
+			ID:           task.ID,
+			MilestoneID:  req.MilestoneID,
+			EpicID:       req.EpicID,
+			ActionPlanID: mile.ActionPlanID,
+			Done:         progress.TaskDone(task),
+			Started:      progress.TaskStarted(task),
+		}); err != nil {
+			return err
+		}
+		taskID = task.ID
+		changed[req.MilestoneID] = true
+	case outbox.OpUpdate:
+		local, err := repo.GetTaskByID(entry.TaskID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && task.ID != 0 {
+			if err := repo.SetDone([]int64{local.ID}, progress.TaskDone(task)); err != nil {
+				return err
+			}
+			if err := repo.SetStarted([]int64{local.ID}, progress.TaskStarted(task)); err != nil {
+				return err
+			}
+			changed[local.MilestoneID] = true
+		}
+		changed[previousMilestone(entry)] = true
+	default:
+		changed[previousMilestone(entry)] = true
+		if local, err := repo.GetTaskByID(entry.TaskID); err == nil {
+			changed[local.MilestoneID] = true
+		}
+	}
+	return outbox.New(tx).Complete(entry.ID, taskID)
+}
+
+// previousMilestone is the milestone the task had when the entry was queued.
+func previousMilestone(entry outbox.EntryEntity) int64 {
+	var previous tasks.TaskEntity
+	if entry.Previous == "" || json.Unmarshal([]byte(entry.Previous), &previous) != nil {
+		return 0
+	}
+	return previous.MilestoneID
+}
+
+// recount refreshes the cached task counts of the changed milestones.
+func recount(tx *gorm.DB, changed map[int64]bool) error {
+	repo := tasks.New(tx)
+	ml := milestone.New(tx)
+	for id := range changed {
+		if id == 0 {
+			continue
+		}
+		done, total, err := repo.CountByMilestoneID(id)
+		if err != nil {
+			return err
+		}
+		if err := ml.SetTaskCounts(id, done, total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish tells the status flow which milestones have changed tasks.
+func (d Dispatcher) publish(changed map[int64]bool) {
+	if d.bus == nil {
+		return
+	}
+	for id := range changed {
+		if id == 0 {
+			continue
+		}
+		d.bus.Publish(events.MilestoneTasksChanged, id)
+	}
+}
+
+// withLinks sets our milestone and epic on a created task.
+func withLinks(entry outbox.EntryEntity, req models.TaskReq, task models.Task) models.Task {
+	if entry.Op == outbox.OpCreate {
+		task.MilestoneId = req.MilestoneID
+		task.EpicID = req.EpicID
+	}
+	return task
+}
+
+func backoff(attempts int) time.Duration {
+	d := firstRetry << uint(attempts)
+	if d > maxRetry || d <= 0 {
+		return maxRetry
+	}
+	return d
+}
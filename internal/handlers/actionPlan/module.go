@@ -1,23 +1,23 @@
 package actionPlan
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"projects/internal/access"
 	"projects/internal/database/actionPlan"
+	"projects/internal/database/assignment"
 	"projects/internal/database/epics"
+	"projects/internal/database/membership"
 	"projects/internal/database/milestone"
 	"projects/internal/database/stage"
 	"projects/internal/database/tasks"
+	assignmentHandler "projects/internal/handlers/assignment"
 	"projects/internal/models"
+	"projects/internal/progress"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/taskclient"
+	"sort"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -39,16 +39,18 @@ type Params struct {
 	db.DbInter
 	*config.Tuner
 	*logrus.Logger
+	taskclient.Client
 }
 
 type actionPlanHandler struct {
-	db   db.DbInter
-	log  *logrus.Logger
-	conf *config.Tuner
+	db    db.DbInter
+	log   *logrus.Logger
+	conf  *config.Tuner
+	tasks taskclient.Client
 }
 
 func NewActionPlanHandler(params Params) ActionPlanHandler {
-	return &actionPlanHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+	return &actionPlanHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner, tasks: params.Client}
 }
 
 func (p actionPlanHandler) DeleteActionPlan(c *gin.Context) {
@@ -63,6 +65,9 @@ func (p actionPlanHandler) DeleteActionPlan(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong id"})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).EditActionPlan(c, id) {
+		return
+	}
 
 	if err := aP.Delete(id); err != nil {
 		p.log.Warnln("Can't delete action plan with err: ", err.Error())
@@ -97,6 +102,9 @@ func (p actionPlanHandler) UpdateActionPlan(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "can`t update title with less then 2 simbols"})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).EditActionPlan(c, id) {
+		return
+	}
 	acPlanEntity, err := aP.Update(id, actionPlanReq.Title, actionPlanReq.Status)
 	if err != nil {
 		p.log.Warnln("Can't update action plan with err: ", err.Error())
@@ -130,6 +138,16 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 
 	stages := st.GetByActionPlan(acPlan.ActionPlanID)
 	miles := ml.GetByActionPlan(acPlan.ActionPlanID)
+	var milesID []int64
+	for _, m := range miles {
+		milesID = append(milesID, m.MilestoneID)
+	}
+	assignments, err := assignment.New(p.db.GetDB()).GetByMilestoneIDs(milesID)
+	if err != nil {
+		p.log.Warnln("Can't get assignees with err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
 	epic, err := epics.NewEpic(p.db.GetDB()).GetEpic(epics.EpicEntity{ActionPlanID: acPlan.ActionPlanID})
 	if err != nil {
 		p.log.Warnln("Can't get action plan with err: ", err.Error())
@@ -145,6 +163,8 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 			MilestoneID: e.MilestoneID,
 			Title:       e.Title,
 			Description: e.Description,
+			Status:      e.Status,
+			Order:       e.Order,
 		}
 		epc[e.ID] = epicResp
 	}
@@ -158,22 +178,12 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 	for _, t := range task {
 		tasksID = append(tasksID, t.ID)
 	}
-	var resp []models.Task
-	if len(tasksID) != 0 {
-
-		headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-		log.Println(headers)
-		arrByte, err := json.Marshal(tasksID)
-		if err != nil {
-			p.log.Warnln("Can't get tasks with err: ", err.Error())
-			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
-			return
-		}
-		if err := p.sendRequest(http.MethodPost, "/tasks/batch", bytes.NewBuffer(arrByte), &resp, &headers); err != nil {
-			p.log.Warn("sendRequest err", err)
-			c.JSON(http.StatusBadGateway, err.Error())
-			return
-		}
+	ctx := access.TaskContext(c)
+	resp, err := p.tasks.Batch(ctx, tasksID)
+	if err != nil {
+		p.log.Warn("task client err", err)
+		c.JSON(taskclient.Status(err), err.Error())
+		return
 	}
 	taskMile := make(map[int64][]models.Task)
 	for _, t := range task {
@@ -198,8 +208,19 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 	}
 	mileEpic := make(map[int64][]models.EpicResponse)
 	for _, e := range epc {
+		e.Progress = progress.Percent(progress.Tasks(e.Task))
+		e.ComputedStatus = string(progress.EpicStatus(milestone.Status(e.Status), e.Task))
 		mileEpic[e.MilestoneID] = append(mileEpic[e.MilestoneID], e)
 	}
+	for _, eps := range mileEpic {
+		sort.Slice(eps, func(i, j int) bool {
+			if eps[i].Order != eps[j].Order {
+				return eps[i].Order < eps[j].Order
+			}
+			return eps[i].ID < eps[j].ID
+		})
+	}
+	stagesProgress := progress.Stages(miles)
 
 	actionPlanResp := models.ActionPlanResp{
 		ActionPlanID: acPlan.ActionPlanID,
@@ -208,6 +229,7 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 		Created:      acPlan.Created,
 		Title:        acPlan.Title,
 		Status:       acPlan.Status.String(),
+		Progress:     progress.ActionPlans(miles)[acPlan.ActionPlanID],
 		Stage: func() []models.Stage {
 			var stagesResp []models.Stage
 			for _, v := range stages {
@@ -218,6 +240,8 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 						Description: v.Description,
 						DateStart:   v.DateStart,
 						DateEnd:     v.DateStop,
+						Progress:    stagesProgress[v.StageID],
+						Overdue:     v.Overdue,
 						Milestone: func() []models.Milestone {
 							var milesResp []models.Milestone
 							for _, mile := range miles {
@@ -232,8 +256,15 @@ func (p actionPlanHandler) DownloadActionPlan(c *gin.Context) {
 											Description: mile.Description,
 											DateStart:   mile.DateStart,
 											DateEnd:     mile.DateStop,
+											AssignID:    mile.AssignID,
+											Assignees:   assignmentHandler.Assignees(assignments[mile.MilestoneID]),
+											Weight:      mile.Weight,
+											Progress:    progress.Milestone(mile),
+											Overdue:     mile.Overdue,
 											Epic:        mileEpic[mile.MilestoneID],
 											Task:        taskMile[mile.MilestoneID],
+
+											CompletionProposed: mile.CompletionProposed,
 										})
 								}
 							}
@@ -287,6 +318,9 @@ func (p actionPlanHandler) CreateActionPlan(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).Workspace(c, actionPlanReq.WorkspaceID, membership.Editor) {
+		return
+	}
 
 	acEntity := actionPlan.ActionPlanEntity{
 		WorkspaceID: actionPlanReq.WorkspaceID,
@@ -304,41 +338,3 @@ func (p actionPlanHandler) CreateActionPlan(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"created_id": acEntity.ActionPlanID})
 }
-
-func (p actionPlanHandler) sendRequest(method, uri string, reader io.Reader, respStruct interface{}, headers *map[string]string) error {
-	req, err := http.NewRequest(method, p.conf.Task.Addr+uri, reader)
-	if err != nil {
-		return err
-	}
-	client := http.Client{
-		Timeout: 15 * time.Second,
-	}
-
-	// req.Header.Set("Content-Type")
-	if headers != nil {
-		for s, v := range *headers {
-			req.Header.Set(s, v)
-		}
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if respStruct != nil {
-			err = json.Unmarshal(body, &respStruct)
-
-			if err != nil {
-				return err
-			}
-		}
-
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return errors.New(string(body))
-	}
-
-	return nil
-}
@@ -0,0 +1,213 @@
+package assignment
+
+import (
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/assignment"
+	"projects/internal/database/milestone"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewAssignmentHandler)
+
+type AssignmentHandler interface {
+	GetAssignees(c *gin.Context)
+	AddAssignee(c *gin.Context)
+	RemoveAssignee(c *gin.Context)
+	GetMyMilestones(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type assignmentHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewAssignmentHandler(params Params) AssignmentHandler {
+	return &assignmentHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+// Assignees converts assignment rows into their response representation.
+func Assignees(entities []assignment.AssignmentEntity) []models.Assignee {
+	var assignees []models.Assignee
+	for _, v := range entities {
+		assignees = append(assignees, models.Assignee{
+			UserID:  v.UserID,
+			Role:    v.Role.String(),
+			Created: v.Created,
+		})
+	}
+	return assignees
+}
+
+func validRole(role assignment.Role) bool {
+	switch role {
+	case assignment.Owner, assignment.Contributor, assignment.Reviewer:
+		return true
+	}
+	return false
+}
+
+func (p assignmentHandler) GetAssignees(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	assignments, err := assignment.New(p.db.GetDB()).GetByMilestoneID(id)
+	if err != nil {
+		p.log.Warnln("get assignees err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	assignees := Assignees(assignments)
+	if assignees == nil {
+		assignees = []models.Assignee{}
+	}
+
+	c.JSON(http.StatusOK, assignees)
+}
+
+func (p assignmentHandler) AddAssignee(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var assigneeReq models.AssigneeReq
+	if err := c.ShouldBindJSON(&assigneeReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if assigneeReq.Role == "" {
+		assigneeReq.Role = string(assignment.Contributor)
+	}
+	if assigneeReq.UserID == "" || !validRole(assignment.Role(assigneeReq.Role)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id and a valid role are required"})
+		return
+	}
+	if milestone.New(p.db.GetDB()).GetMilestoneByID(id).MilestoneID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "milestone not found"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, id) {
+		return
+	}
+
+	entity := assignment.AssignmentEntity{
+		MilestoneID: id,
+		UserID:      assigneeReq.UserID,
+		Role:        assignment.Role(assigneeReq.Role),
+	}
+	if err := assignment.New(p.db.GetDB()).Add(&entity); err != nil {
+		p.log.Warnln("add assignee err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Assignee{
+		UserID:  entity.UserID,
+		Role:    entity.Role.String(),
+		Created: entity.Created,
+	})
+}
+
+func (p assignmentHandler) RemoveAssignee(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+	role := assignment.Role(c.Query("role"))
+	if role != "" && !validRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong role"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, id) {
+		return
+	}
+
+	if err := assignment.New(p.db.GetDB()).Remove(id, userID, role); err != nil {
+		p.log.Warnln("remove assignee err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// GetMyMilestones lists the milestones of the caller, the user_id of the path
+// only counts when auth is disabled.
+func (p assignmentHandler) GetMyMilestones(c *gin.Context) {
+	userID := access.Named(c, c.Param("user_id"))
+	role := assignment.Role(c.Query("role"))
+	if role != "" && !validRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong role"})
+		return
+	}
+
+	repo := assignment.New(p.db.GetDB())
+	miles, err := repo.GetMilestonesByUser(userID, role)
+	if err != nil {
+		p.log.Warnln("get milestones by user err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var ids []int64
+	for _, m := range miles {
+		ids = append(ids, m.MilestoneID)
+	}
+	assignments, err := repo.GetByMilestoneIDs(ids)
+	if err != nil {
+		p.log.Warnln("get assignees err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	ms := []models.Milestone{}
+	for _, m := range miles {
+		ms = append(ms, models.Milestone{
+			MilestoneID: m.MilestoneID,
+			ProjectID:   m.ProjectID,
+			StageID:     m.StageID,
+			Order:       m.Order,
+			DateStart:   m.DateStart,
+			DateEnd:     m.DateStop,
+			Description: m.Description,
+			Title:       m.Title,
+			Status:      m.Status.String(),
+			AssignID:    m.AssignID,
+			ProcessID:   m.ProcessID,
+			Assignees:   Assignees(assignments[m.MilestoneID]),
+
+			ActualStart:  m.ActualStart,
+			ActualFinish: m.ActualFinish,
+		})
+	}
+
+	c.JSON(http.StatusOK, ms)
+}
@@ -0,0 +1,207 @@
+package checklist
+
+import (
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/checklist"
+	"projects/internal/database/milestone"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewChecklistHandler)
+
+type ChecklistHandler interface {
+	GetChecklist(c *gin.Context)
+	CreateItems(c *gin.Context)
+	UpdateItem(c *gin.Context)
+	DeleteItem(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type checklistHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewChecklistHandler(params Params) ChecklistHandler {
+	return &checklistHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+func itemResp(item checklist.ChecklistItemEntity) models.ChecklistItem {
+	return models.ChecklistItem{
+		ID:          item.ID,
+		MilestoneID: item.MilestoneID,
+		Title:       item.Title,
+		Order:       item.Order,
+		Required:    item.Required,
+		Done:        item.Done,
+		DoneBy:      item.DoneBy,
+		DoneAt:      item.DoneAt,
+	}
+}
+
+func (p checklistHandler) GetChecklist(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, err := checklist.New(p.db.GetDB()).GetByMilestoneID(id)
+	if err != nil {
+		p.log.Warnln("get checklist err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.ChecklistItem{}
+	for _, item := range items {
+		resp = append(resp, itemResp(item))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p checklistHandler) CreateItems(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var itemsReq []models.ChecklistItemReq
+	if err := c.ShouldBindJSON(&itemsReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if milestone.New(p.db.GetDB()).GetMilestoneByID(id).MilestoneID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "milestone not found"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, id) {
+		return
+	}
+
+	var items []checklist.ChecklistItemEntity
+	for i, v := range itemsReq {
+		if v.Title == nil || *v.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+			return
+		}
+		item := checklist.ChecklistItemEntity{MilestoneID: id, Title: *v.Title, Order: i + 1}
+		if v.Order != nil {
+			item.Order = *v.Order
+		}
+		if v.Required != nil {
+			item.Required = *v.Required
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no items"})
+		return
+	}
+
+	items, err = checklist.New(p.db.GetDB()).Create(items)
+	if err != nil {
+		p.log.Warnln("create checklist err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var resp []models.ChecklistItem
+	for _, item := range items {
+		resp = append(resp, itemResp(item))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p checklistHandler) UpdateItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var itemReq models.ChecklistItemReq
+	if err := c.ShouldBindJSON(&itemReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if !p.editItem(c, id) {
+		return
+	}
+
+	repo := checklist.New(p.db.GetDB())
+	updateColumns := make(map[string]interface{})
+	if itemReq.Title != nil {
+		updateColumns["title"] = *itemReq.Title
+	}
+	if itemReq.Order != nil {
+		updateColumns["order"] = *itemReq.Order
+	}
+	if itemReq.Required != nil {
+		updateColumns["required"] = *itemReq.Required
+	}
+	item, err := repo.Update(id, updateColumns)
+	if err != nil {
+		p.log.Warnln("update checklist item err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if itemReq.Done != nil && *itemReq.Done != item.Done {
+		if item, err = repo.Check(id, *itemReq.Done, access.UserID(c)); err != nil {
+			p.log.Warnln("check checklist item err: ", err.Error())
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, itemResp(item))
+}
+
+func (p checklistHandler) DeleteItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if !p.editItem(c, id) {
+		return
+	}
+
+	if err := checklist.New(p.db.GetDB()).Delete(id); err != nil {
+		p.log.Warnln("delete checklist item err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// editItem requires the editor role in the workspace of the item's milestone.
+func (p checklistHandler) editItem(c *gin.Context, id int64) bool {
+	item, err := checklist.New(p.db.GetDB()).Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "checklist item not found"})
+		return false
+	}
+	return access.New(p.db.GetDB(), p.log).EditMilestone(c, item.MilestoneID)
+}
@@ -1,16 +1,28 @@
 package epic
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"projects/internal/access"
 	"projects/internal/database/epics"
+	"projects/internal/database/membership"
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/dispatcher"
 	"projects/internal/models"
+	"projects/internal/progress"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
+	"gorm.io/gorm"
 )
 
 var Module = fx.Provide(NewEpicHandler)
@@ -20,6 +32,7 @@ type EpicHandler interface {
 	GetEpics(c *gin.Context)
 	UpdateEpic(c *gin.Context)
 	DeleteEpic(c *gin.Context)
+	MoveEpic(c *gin.Context)
 }
 
 type Params struct {
@@ -27,17 +40,32 @@ type Params struct {
 	db.DbInter
 	*config.Tuner
 	*logrus.Logger
+	events.Bus
+	taskclient.Client
 }
 
 type epicHandler struct {
-	db  db.DbInter
-	log *logrus.Logger
+	db    db.DbInter
+	bus   events.Bus
+	log   *logrus.Logger
+	conf  *config.Tuner
+	tasks taskclient.Client
 }
 
 func NewEpicHandler(params Params) EpicHandler {
-	return &epicHandler{db: params.DbInter, log: params.Logger}
+	return &epicHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner, tasks: params.Client}
 }
 
+// what DeleteEpic does with the tasks of the epic
+const (
+	tasksDetach = "detach"
+	tasksMove   = "move"
+	tasksDelete = "delete"
+)
+
+// sendConcurrency limits the task service calls in flight for one epic.
+const sendConcurrency = 8
+
 func (p epicHandler) CreateEpic(c *gin.Context) {
 	var epic models.EpicRequest
 	if err := c.ShouldBindJSON(&epic); err != nil {
@@ -45,6 +73,18 @@ func (p epicHandler) CreateEpic(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
+	if epic.Status != "" && !milestone.Status(epic.Status).Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong status"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if epic.MilestoneID > 0 {
+		if !checker.EditMilestone(c, epic.MilestoneID) {
+			return
+		}
+	} else if !checker.Workspace(c, epic.WorkspaceID, membership.Editor) {
+		return
+	}
 
 	newEpic, err := epics.NewEpic(p.db.GetDB()).CreateEpic(epics.EpicEntity{
 		WorkspaceID: epic.WorkspaceID,
@@ -53,6 +93,8 @@ func (p epicHandler) CreateEpic(c *gin.Context) {
 		MilestoneID: epic.MilestoneID,
 		Title:       epic.Title,
 		Description: epic.Description,
+		Status:      epic.Status,
+		Order:       epic.Order,
 	})
 	if err != nil {
 		p.log.Warnln(err)
@@ -68,6 +110,8 @@ func (p epicHandler) CreateEpic(c *gin.Context) {
 		MilestoneID: newEpic.MilestoneID,
 		Title:       newEpic.Title,
 		Description: newEpic.Description,
+		Status:      newEpic.Status,
+		Order:       newEpic.Order,
 	})
 }
 
@@ -92,12 +136,18 @@ func (p epicHandler) GetEpics(c *gin.Context) {
 	if epic.StageID > 0 {
 		epicEntity.StageID = epic.StageID
 	}
-	eps, err := epics.NewEpic(p.db.GetDB()).GetEpic(epicEntity)
+	eps, err := epics.NewEpic(p.db.GetDB()).GetEpic(epicEntity, epic.TagIDs...)
 	if err != nil {
 		p.log.Warnln(err)
 		c.JSON(http.StatusBadGateway, "can't get epics")
 		return
 	}
+	statuses, err := progress.EpicStatuses(tasks.New(p.db.GetDB()), eps)
+	if err != nil {
+		p.log.Warnln(err)
+		c.JSON(http.StatusBadGateway, "can't get epic tasks")
+		return
+	}
 
 	var response []models.EpicResponse
 	for _, ep := range eps {
@@ -109,6 +159,10 @@ func (p epicHandler) GetEpics(c *gin.Context) {
 			StageID:     ep.StageID,
 			Title:       ep.Title,
 			Description: ep.Description,
+			Status:      ep.Status,
+			Order:       ep.Order,
+
+			ComputedStatus: string(statuses[ep.ID]),
 		})
 	}
 
@@ -129,13 +183,42 @@ func (p epicHandler) UpdateEpic(c *gin.Context) {
 		return
 	}
 	epic.ID = id
+	if epic.Status != "" && !milestone.Status(epic.Status).Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong status"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditEpic(c, id) {
+		return
+	}
+
+	if epic.MilestoneID > 0 {
+		current, err := epics.NewEpic(p.db.GetDB()).GetEpicByID(id)
+		if err != nil {
+			p.log.Warnln(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "epic not found"})
+			return
+		}
+		if current.MilestoneID != epic.MilestoneID {
+			if !checker.EditMilestone(c, epic.MilestoneID) {
+				return
+			}
+			// milestone change has to re-parent the tasks as well
+			ctx := access.TaskContext(c)
+			if _, err := p.move(ctx, access.Caller(c), id, epic.MilestoneID, nil); err != nil {
+				p.log.Warnln(err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
 
 	if err := epics.NewEpic(p.db.GetDB()).UpdateEpic(epics.EpicEntity{
 		ID:          epic.ID,
-		StageID:     epic.StageID,
-		MilestoneID: epic.MilestoneID,
 		Title:       epic.Title,
 		Description: epic.Description,
+		Status:      epic.Status,
+		Order:       epic.Order,
 	}); err != nil {
 		p.log.Warnln(err)
 		c.JSON(http.StatusBadGateway, "can't update epic")
@@ -145,6 +228,10 @@ func (p epicHandler) UpdateEpic(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": "ok"})
 }
 
+// DeleteEpic hides the epic. The tasks query parameter decides what happens to
+// its tasks: detach (default) keeps them under the milestone, move re-parents
+// them to target_epic_id and delete removes them in the task service as well.
+// The task service side goes through the outbox.
 func (p epicHandler) DeleteEpic(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -152,12 +239,163 @@ func (p epicHandler) DeleteEpic(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	mode := c.DefaultQuery("tasks", tasksDetach)
+	if mode != tasksDetach && mode != tasksMove && mode != tasksDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tasks must be detach, move or delete"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditEpic(c, id) {
+		return
+	}
 
-	if err := epics.NewEpic(p.db.GetDB()).DeleteEpic(id); err != nil {
+	epicRepo := epics.NewEpic(p.db.GetDB())
+	epicEntity, err := epicRepo.GetEpicByID(id)
+	if err != nil {
+		p.log.Warnln(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "epic not found"})
+		return
+	}
+	var target epics.EpicEntity
+	if mode == tasksMove {
+		targetID, err := strconv.ParseInt(c.Query("target_epic_id"), 10, 64)
+		if err != nil || targetID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong target epic id"})
+			return
+		}
+		if target, err = epicRepo.GetEpicByID(targetID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target epic not found"})
+			return
+		}
+		if !checker.EditEpic(c, targetID) {
+			return
+		}
+	}
+
+	// the task service changes are queued with the local ones and sent after the commit
+	var entries []outbox.EntryEntity
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		taskRepo := tasks.New(tx)
+		taskIDs, err := taskRepo.GetTaskIDsByEpicID(epicEntity.ID)
+		if err != nil {
+			return err
+		}
+		caller := access.Caller(c)
+		switch mode {
+		case tasksDelete:
+			if entries, err = dispatcher.Queue(tx, outbox.OpDelete, taskIDs, models.TaskReq{}, caller); err == nil {
+				err = taskRepo.DeleteByEpicID(epicEntity.ID)
+			}
+		case tasksMove:
+			req := models.TaskReq{MilestoneID: target.MilestoneID, EpicID: target.ID}
+			if entries, err = dispatcher.Queue(tx, outbox.OpReparent, taskIDs, req, caller); err == nil {
+				err = taskRepo.MoveEpicTasks(epicEntity.ID, target)
+			}
+		default:
+			req := models.TaskReq{MilestoneID: epicEntity.MilestoneID}
+			if entries, err = dispatcher.Queue(tx, outbox.OpReparent, taskIDs, req, caller); err == nil {
+				err = taskRepo.DetachEpicTasks(epicEntity.ID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return epics.NewEpic(tx).DeleteEpic(id)
+	})
+	if err != nil {
 		p.log.Warnln(err)
 		c.JSON(http.StatusBadGateway, "can't delete epic")
 		return
 	}
+	p.send(access.TaskContext(c), entries)
 
-	c.JSON(http.StatusOK, gin.H{"success": "ok"})
+	c.JSON(http.StatusOK, gin.H{"success": "ok", "tasks": mode, "affected_tasks": len(entries)})
+}
+
+func (p epicHandler) MoveEpic(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var moveReq models.EpicMove
+	if err := c.ShouldBindJSON(&moveReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, err.Error())
+		return
+	}
+	if moveReq.MilestoneID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong milestone id"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditEpic(c, id) || !checker.EditMilestone(c, moveReq.MilestoneID) {
+		return
+	}
+
+	ctx := access.TaskContext(c)
+	moved, err := p.move(ctx, access.Caller(c), id, moveReq.MilestoneID, moveReq.Order)
+	if err != nil {
+		p.log.Warnln(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.EpicResponse{
+		ID:          moved.ID,
+		WorkspaceID: moved.WorkspaceID,
+		ProjectID:   moved.ProjectID,
+		StageID:     moved.StageID,
+		MilestoneID: moved.MilestoneID,
+		Title:       moved.Title,
+		Description: moved.Description,
+		Status:      moved.Status,
+		Order:       moved.Order,
+	})
+}
+
+// move re-parents the epic and its tasks locally and queues the task service
+// updates in the same transaction. They are sent after the commit, updates
+// the task service can't take yet are left to the outbox worker and rejected
+// ones restore the task row.
+func (p epicHandler) move(ctx context.Context, caller events.Caller, id, milestoneID int64, order *int) (epics.EpicEntity, error) {
+	var moved epics.EpicEntity
+	var entries []outbox.EntryEntity
+	err := p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		taskIDs, err := tasks.New(tx).GetTaskIDsByEpicID(id)
+		if err != nil {
+			return err
+		}
+		req := models.TaskReq{MilestoneID: milestoneID, EpicID: id}
+		if entries, err = dispatcher.Queue(tx, outbox.OpReparent, taskIDs, req, caller); err != nil {
+			return err
+		}
+		if moved, _, err = epics.NewEpic(tx).Move(id, milestoneID); err != nil {
+			return err
+		}
+		if order != nil && *order != moved.Order {
+			moved.Order = *order
+			return tx.Model(epics.EpicEntity{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{"order": moved.Order}).Error
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return epics.EpicEntity{}, errors.New("epic not found")
+	}
+	if err != nil {
+		return epics.EpicEntity{}, err
+	}
+	p.send(ctx, entries)
+	return moved, nil
+}
+
+// send dispatches queued task changes, failed ones stay visible in the outbox.
+func (p epicHandler) send(ctx context.Context, entries []outbox.EntryEntity) {
+	d := dispatcher.New(p.db.GetDB(), p.tasks, p.bus, p.log, p.conf.Scheduler.OutboxMaxAttempts)
+	for _, o := range d.DispatchBatch(ctx, entries, sendConcurrency) {
+		if o.Err != nil {
+			p.log.Warnln("task change not sent ", o.Entry.TaskID, o.Err)
+		}
+	}
 }
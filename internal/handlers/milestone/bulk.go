@@ -0,0 +1,214 @@
+package milestone
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/assignment"
+	"projects/internal/database/milestone"
+	"projects/internal/models"
+	"projects/pkg/dates"
+	"projects/pkg/events"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	bulkAtomic     = "atomic"
+	bulkBestEffort = "best_effort"
+
+	maxBulkItems = 500
+)
+
+// BulkUpdateMilestones applies partial updates to many milestones in a single
+// transaction. Every item runs in its own savepoint: in atomic mode one failure
+// rolls back the whole batch, in best effort mode only the failed items.
+func (p milestoneHandler) BulkUpdateMilestones(c *gin.Context) {
+	var bulkReq models.MilestoneBulk
+	if err := c.ShouldBindJSON(&bulkReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if bulkReq.Mode == "" {
+		bulkReq.Mode = bulkAtomic
+	}
+	if bulkReq.Mode != bulkAtomic && bulkReq.Mode != bulkBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or best_effort"})
+		return
+	}
+	if (bulkReq.Filter == nil) == (len(bulkReq.Items) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either items or filter is required"})
+		return
+	}
+	if bulkReq.Filter != nil && bulkReq.Update == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "update is required with filter"})
+		return
+	}
+	if f := bulkReq.Filter; f != nil && f.ProjectID == 0 && f.ActionPlanID == 0 && f.StageID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filter needs one of project_id, action_plan_id or stage_id"})
+		return
+	}
+
+	tx := p.db.GetDB().Begin()
+	if tx.Error != nil {
+		p.log.Warnln("begin error ", tx.Error)
+		c.JSON(http.StatusBadGateway, gin.H{"error": tx.Error.Error()})
+		return
+	}
+
+	patches := bulkReq.Items
+	if bulkReq.Filter != nil {
+		miles, err := milestone.New(tx).Find(milestone.Filter{
+			ProjectID:    bulkReq.Filter.ProjectID,
+			ActionPlanID: bulkReq.Filter.ActionPlanID,
+			StageID:      bulkReq.Filter.StageID,
+			Status:       milestone.Status(bulkReq.Filter.Status),
+		})
+		if err != nil {
+			tx.Rollback()
+			p.log.Warnln("find milestones error ", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		for _, m := range miles {
+			patch := *bulkReq.Update
+			patch.MilestoneID = m.MilestoneID
+			patches = append(patches, patch)
+		}
+	}
+	if len(patches) > maxBulkItems {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many milestones in one request"})
+		return
+	}
+
+	result := models.BulkResult{Mode: bulkReq.Mode, Results: []models.BulkItemResult{}}
+	failed := false
+	var statusChanged []milestone.MilestoneEntity
+	checker := access.New(p.db.GetDB(), p.log)
+	for _, patch := range patches {
+		var changed *milestone.MilestoneEntity
+		err := validatePatch(patch)
+		if err == nil {
+			err = checker.MilestoneAllowed(c, patch.MilestoneID)
+		}
+		if err == nil {
+			err = tx.Transaction(func(sp *gorm.DB) (err error) {
+				changed, err = applyPatch(sp, patch, access.UserID(c))
+				return err
+			})
+		}
+		itemResult := models.BulkItemResult{MilestoneID: patch.MilestoneID, Success: err == nil}
+		if err != nil {
+			failed = true
+			itemResult.Error = err.Error()
+		} else if changed != nil {
+			statusChanged = append(statusChanged, *changed)
+		}
+		result.Results = append(result.Results, itemResult)
+	}
+
+	if failed && bulkReq.Mode == bulkAtomic {
+		tx.Rollback()
+		for i := range result.Results {
+			if result.Results[i].Success {
+				result.Results[i].Success = false
+				result.Results[i].Error = "rolled back"
+			}
+		}
+		c.JSON(http.StatusConflict, result)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		p.log.Warnln("commit error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	result.Committed = true
+	for _, m := range statusChanged {
+		p.bus.PublishAs(events.MilestoneStatusChanged, m, access.Caller(c))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// validatePatch rejects values the database would fail on, an empty date
+// clears it.
+func validatePatch(patch models.MilestonePatch) error {
+	if patch.Status != nil && !milestone.Status(*patch.Status).Valid() {
+		return fmt.Errorf("wrong status %q", *patch.Status)
+	}
+	if err := validDate("date_start", patch.DateStart); err != nil {
+		return err
+	}
+	return validDate("date_end", patch.DateEnd)
+}
+
+func validDate(field string, value *string) error {
+	if value == nil || *value == "" {
+		return nil
+	}
+	if _, ok := dates.Parse(*value); !ok {
+		return fmt.Errorf("wrong %s %q", field, *value)
+	}
+	return nil
+}
+
+// applyPatch returns the milestone when its status changed.
+func applyPatch(tx *gorm.DB, patch models.MilestonePatch, changedBy string) (*milestone.MilestoneEntity, error) {
+	repo := milestone.New(tx)
+	current := repo.GetMilestoneByID(patch.MilestoneID)
+	if patch.MilestoneID <= 0 || current.MilestoneID == 0 {
+		return nil, errors.New("milestone not found")
+	}
+
+	var statusChanged *milestone.MilestoneEntity
+	if patch.Status != nil {
+		changed, err := repo.ChangeStatus(patch.MilestoneID, milestone.Status(*patch.Status), changedBy, patch.StatusComment)
+		if err != nil {
+			return nil, err
+		}
+		if changed.Status != current.Status {
+			statusChanged = &changed
+		}
+	}
+	if patch.AssignID != nil {
+		if *patch.AssignID == "" {
+			return nil, errors.New("assign_id can't be empty")
+		}
+		if err := assignment.New(tx).Add(&assignment.AssignmentEntity{
+			MilestoneID: patch.MilestoneID,
+			UserID:      *patch.AssignID,
+			Role:        assignment.Owner,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	updateColumns := make(map[string]interface{})
+	if patch.Title != nil {
+		updateColumns["title"] = *patch.Title
+	}
+	if patch.Description != nil {
+		updateColumns["description"] = *patch.Description
+	}
+	if patch.DateStart != nil {
+		updateColumns["date_start"] = *patch.DateStart
+	}
+	if patch.DateEnd != nil {
+		updateColumns["date_stop"] = *patch.DateEnd
+	}
+	if patch.Order != nil {
+		updateColumns["order"] = *patch.Order
+	}
+	if patch.Weight != nil {
+		updateColumns["weight"] = *patch.Weight
+	}
+	if err := repo.UpdateColumns(patch.MilestoneID, updateColumns); err != nil {
+		return nil, err
+	}
+	return statusChanged, nil
+}
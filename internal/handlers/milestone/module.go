@@ -1,16 +1,24 @@
 package milestone
 
 import (
+	"errors"
 	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/assignment"
 	"projects/internal/database/milestone"
+	"projects/internal/database/processes"
+	assignmentHandler "projects/internal/handlers/assignment"
 	"projects/internal/models"
+	"projects/internal/progress"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
+	"gorm.io/gorm"
 )
 
 var Module = fx.Provide(NewMilestoneHandler)
@@ -21,11 +29,15 @@ type MilestoneHandler interface {
 	CreateMilestone(c *gin.Context)
 	EditMilestone(c *gin.Context)
 	DeleteMilestone(c *gin.Context)
+	MoveMilestone(c *gin.Context)
+	GetStatusHistory(c *gin.Context)
+	BulkUpdateMilestones(c *gin.Context)
 }
 
 type Params struct {
 	fx.In
 	db.DbInter
+	events.Bus
 	*config.Tuner
 	*logrus.Logger
 }
@@ -34,10 +46,11 @@ type milestoneHandler struct {
 	db   db.DbInter
 	log  *logrus.Logger
 	conf *config.Tuner
+	bus  events.Bus
 }
 
 func NewMilestoneHandler(params Params) MilestoneHandler {
-	return &milestoneHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+	return &milestoneHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner}
 }
 
 func (p milestoneHandler) GetMilestoneByID(c *gin.Context) {
@@ -50,6 +63,12 @@ func (p milestoneHandler) GetMilestoneByID(c *gin.Context) {
 
 	repo := milestone.New(p.db.GetDB())
 	milestoneEnt := repo.GetMilestoneByID(id)
+	assignments, err := assignment.New(p.db.GetDB()).GetByMilestoneID(id)
+	if err != nil {
+		p.log.Warnln("get assignees error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, models.Milestone{
 		MilestoneID: milestoneEnt.MilestoneID,
@@ -61,6 +80,17 @@ func (p milestoneHandler) GetMilestoneByID(c *gin.Context) {
 		DateEnd:     milestoneEnt.DateStop,
 		Title:       milestoneEnt.Title,
 		AssignID:    milestoneEnt.AssignID,
+		ProcessID:   milestoneEnt.ProcessID,
+		Assignees:   assignmentHandler.Assignees(assignments),
+		Weight:      milestoneEnt.Weight,
+		Progress:    progress.Milestone(milestoneEnt),
+		Overdue:     milestoneEnt.Overdue,
+
+		RequireChecklist:   &milestoneEnt.RequireChecklist,
+		CompletionProposed: milestoneEnt.CompletionProposed,
+
+		ActualStart:  milestoneEnt.ActualStart,
+		ActualFinish: milestoneEnt.ActualFinish,
 	})
 }
 
@@ -74,14 +104,45 @@ func (p milestoneHandler) GetMilestones(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong id"})
 		return
 	}
+	if stageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong id"})
+		return
+	}
+
+	var tagIDs []int64
+	for _, v := range values["tag_id"] {
+		tagID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			p.log.Warnln("Param err: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong tag id"})
+			return
+		}
+		tagIDs = append(tagIDs, tagID)
+	}
 
 	mRepo := milestone.New(p.db.GetDB())
-	milestones := mRepo.GetByStageID(int64(stageID))
+	milestones, err := mRepo.Find(milestone.Filter{StageID: int64(stageID), TagIDs: tagIDs})
+	if err != nil {
+		p.log.Warnln("find milestones error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
 	if len(milestones) == 0 {
 		c.JSON(http.StatusOK, gin.H{})
 		return
 	}
 
+	var ids []int64
+	for _, m := range milestones {
+		ids = append(ids, m.MilestoneID)
+	}
+	assignments, err := assignment.New(p.db.GetDB()).GetByMilestoneIDs(ids)
+	if err != nil {
+		p.log.Warnln("get assignees error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
 	var ms []models.Milestone
 	for _, m := range milestones {
 		ms = append(ms, models.Milestone{
@@ -95,6 +156,16 @@ func (p milestoneHandler) GetMilestones(c *gin.Context) {
 			Title:       m.Title,
 			Status:      m.Status.String(),
 			AssignID:    m.AssignID,
+			ProcessID:   m.ProcessID,
+			Assignees:   assignmentHandler.Assignees(assignments[m.MilestoneID]),
+			Weight:      m.Weight,
+			Progress:    progress.Milestone(m),
+			Overdue:     m.Overdue,
+
+			CompletionProposed: m.CompletionProposed,
+
+			ActualStart:  m.ActualStart,
+			ActualFinish: m.ActualFinish,
 		})
 	}
 
@@ -109,6 +180,34 @@ func (p milestoneHandler) CreateMilestone(c *gin.Context) {
 		return
 	}
 
+	checker := access.New(p.db.GetDB(), p.log)
+	stages := make(map[int64]bool)
+	for _, m := range milestoneReq.Milestones {
+		if stages[m.StageID] {
+			continue
+		}
+		if !checker.EditStage(c, m.StageID) {
+			return
+		}
+		stages[m.StageID] = true
+	}
+
+	checked := make(map[int64]bool)
+	for _, m := range milestoneReq.Milestones {
+		if m.ProcessID == 0 || checked[m.ProcessID] {
+			continue
+		}
+		proc, err := processes.New(p.db.GetDB()).GetByID(m.ProcessID)
+		if err == nil && !proc.Active {
+			err = processes.ErrInactive
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		checked[m.ProcessID] = true
+	}
+
 	mRepo := milestone.New(p.db.GetDB())
 	var milestones []milestone.MilestoneEntity
 	for _, m := range milestoneReq.Milestones {
@@ -123,6 +222,7 @@ func (p milestoneHandler) CreateMilestone(c *gin.Context) {
 			DateStop:    m.DateEnd,
 			AssignID:    m.AssignID,
 			ProcessID:   m.ProcessID,
+			Weight:      m.Weight,
 		})
 	}
 
@@ -131,6 +231,20 @@ func (p milestoneHandler) CreateMilestone(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	aRepo := assignment.New(p.db.GetDB())
+	for _, m := range miles {
+		if m.AssignID == "" {
+			continue
+		}
+		if err := aRepo.Add(&assignment.AssignmentEntity{MilestoneID: m.MilestoneID, UserID: m.AssignID, Role: assignment.Owner}); err != nil {
+			p.log.Warnln("add owner error ", err)
+		}
+	}
+	for _, m := range miles {
+		if m.ProcessID > 0 {
+			p.bus.PublishAs(events.MilestoneProcessLinked, m, access.Caller(c))
+		}
+	}
 
 	var ms []models.Milestone
 	for _, m := range miles {
@@ -165,36 +279,108 @@ func (p milestoneHandler) EditMilestone(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	if milestoneReq.Status != "" && !milestone.Status(milestoneReq.Status).Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong status"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditMilestone(c, id) {
+		return
+	}
 
 	mileDB := milestone.New(p.db.GetDB())
-	milestoneEntity := milestone.MilestoneEntity{
-		MilestoneID: id,
-		StageID:     milestoneReq.StageID,
-		Title:       milestoneReq.Title,
-		Description: milestoneReq.Description,
-		Order:       milestoneReq.Order,
-		Status:      milestone.Status(milestoneReq.Status),
-		DateStart:   milestoneReq.DateStart,
-		DateStop:    milestoneReq.DateEnd,
-		AssignID:    milestoneReq.AssignID,
-	}
-
-	mile, err := mileDB.Update(milestoneEntity)
-	if err != nil {
-		p.log.Warnln("update error")
-		c.JSON(http.StatusBadGateway, gin.H{"error": "update error"})
+	current := mileDB.GetMilestoneByID(id)
+	if milestoneReq.StageID > 0 && current.StageID != milestoneReq.StageID && !checker.EditStage(c, milestoneReq.StageID) {
 		return
 	}
+
+	// the edit is applied as a whole, events go out after the commit
+	var statusChanged, processLinked bool
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		repo := milestone.New(tx)
+		if milestoneReq.StageID > 0 && current.StageID != milestoneReq.StageID {
+			// stage change has to re-parent epics and tasks as well
+			if _, err := repo.Move(id, milestoneReq.StageID); err != nil {
+				return err
+			}
+		}
+		if milestoneReq.RequireChecklist != nil {
+			if err := repo.SetRequireChecklist(id, *milestoneReq.RequireChecklist); err != nil {
+				return err
+			}
+		}
+		if milestoneReq.Status != "" {
+			changed, err := repo.ChangeStatus(id, milestone.Status(milestoneReq.Status), access.UserID(c), milestoneReq.StatusComment)
+			if err != nil {
+				return err
+			}
+			statusChanged = changed.Status != current.Status
+		}
+		if milestoneReq.ProcessID > 0 {
+			linked, err := processes.New(tx).Link(milestoneReq.ProcessID, []int64{id})
+			if err != nil {
+				return err
+			}
+			processLinked = len(linked) > 0
+		}
+		if milestoneReq.AssignID != "" {
+			if err := assignment.New(tx).Add(&assignment.AssignmentEntity{
+				MilestoneID: id,
+				UserID:      milestoneReq.AssignID,
+				Role:        assignment.Owner,
+			}); err != nil {
+				return err
+			}
+		}
+		_, err := repo.Update(milestone.MilestoneEntity{
+			MilestoneID: id,
+			Title:       milestoneReq.Title,
+			Description: milestoneReq.Description,
+			Order:       milestoneReq.Order,
+			DateStart:   milestoneReq.DateStart,
+			DateStop:    milestoneReq.DateEnd,
+			Weight:      milestoneReq.Weight,
+		})
+		return err
+	})
+	switch {
+	case errors.Is(err, milestone.ErrChecklistIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, processes.ErrNotFound) || errors.Is(err, processes.ErrInactive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		p.log.Warnln("update error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	mile := mileDB.GetMilestoneByID(id)
+	if statusChanged {
+		p.bus.PublishAs(events.MilestoneStatusChanged, mile, access.Caller(c))
+	}
+	if processLinked {
+		p.bus.PublishAs(events.MilestoneProcessLinked, mile, access.Caller(c))
+	}
 	milestoneResp := models.Milestone{
 		MilestoneID: mile.MilestoneID,
-		AssignID:    milestoneReq.AssignID,
-		StageID:     milestoneReq.StageID,
+		AssignID:    mile.AssignID,
+		StageID:     mile.StageID,
 		Title:       mile.Title,
 		Description: mile.Description,
 		Status:      mile.Status.String(),
 		DateStart:   mile.DateStart,
 		DateEnd:     mile.DateStop,
 		Order:       mile.Order,
+		Weight:      mile.Weight,
+		Progress:    progress.Milestone(mile),
+		Overdue:     mile.Overdue,
+
+		RequireChecklist:   &mile.RequireChecklist,
+		CompletionProposed: mile.CompletionProposed,
+
+		ActualStart:  mile.ActualStart,
+		ActualFinish: mile.ActualFinish,
 	}
 
 	c.JSON(http.StatusOK, milestoneResp)
@@ -207,6 +393,9 @@ func (p milestoneHandler) DeleteMilestone(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, id) {
+		return
+	}
 
 	mileDB := milestone.New(p.db.GetDB())
 	if err := mileDB.DeleteByID(id); err != nil {
@@ -217,3 +406,89 @@ func (p milestoneHandler) DeleteMilestone(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
+
+func (p milestoneHandler) MoveMilestone(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var moveReq models.MilestoneMove
+	if err := c.ShouldBindJSON(&moveReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if moveReq.StageID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong stage id"})
+		return
+	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditMilestone(c, id) || !checker.EditStage(c, moveReq.StageID) {
+		return
+	}
+
+	var mile milestone.MilestoneEntity
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		mileDB := milestone.New(tx)
+		if mile, err = mileDB.Move(id, moveReq.StageID); err != nil {
+			return err
+		}
+		if moveReq.Order == nil {
+			return nil
+		}
+		mile.Order = *moveReq.Order
+		return mileDB.UpdateColumns(id, map[string]interface{}{"order": mile.Order})
+	})
+	if err != nil {
+		p.log.Warnln("move error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Milestone{
+		MilestoneID: mile.MilestoneID,
+		ProjectID:   mile.ProjectID,
+		StageID:     mile.StageID,
+		Order:       mile.Order,
+		Status:      mile.Status.String(),
+		DateStart:   mile.DateStart,
+		DateEnd:     mile.DateStop,
+		Description: mile.Description,
+		Title:       mile.Title,
+		AssignID:    mile.AssignID,
+		ProcessID:   mile.ProcessID,
+	})
+}
+
+func (p milestoneHandler) GetStatusHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := milestone.New(p.db.GetDB()).GetStatusHistory(id)
+	if err != nil {
+		p.log.Warnln("get status history error ", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeline := []models.MilestoneStatusChange{}
+	for _, h := range history {
+		timeline = append(timeline, models.MilestoneStatusChange{
+			ID:          h.ID,
+			MilestoneID: h.MilestoneID,
+			From:        h.From.String(),
+			To:          h.To.String(),
+			UserID:      h.UserID,
+			Comment:     h.Comment,
+			Created:     h.Created,
+		})
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
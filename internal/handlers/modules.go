@@ -2,24 +2,38 @@ package handlers
 
 import (
 	"projects/internal/handlers/actionPlan"
+	"projects/internal/handlers/assignment"
+	"projects/internal/handlers/checklist"
 	"projects/internal/handlers/epic"
 	"projects/internal/handlers/milestone"
+	"projects/internal/handlers/overdue"
 	"projects/internal/handlers/processes"
 	"projects/internal/handlers/project"
+	"projects/internal/handlers/reports"
 	"projects/internal/handlers/stage"
+	"projects/internal/handlers/tags"
 	"projects/internal/handlers/task"
 	"projects/internal/handlers/template"
+	"projects/internal/handlers/webhook"
+	"projects/internal/handlers/workspace"
 
 	"go.uber.org/fx"
 )
 
 var Modules = fx.Options(
 	actionPlan.Module,
+	assignment.Module,
+	checklist.Module,
 	epic.Module,
 	milestone.Module,
+	overdue.Module,
 	stage.Module,
 	processes.Module,
 	project.Module,
+	reports.Module,
+	tags.Module,
 	task.Module,
 	template.Module,
+	webhook.Module,
+	workspace.Module,
 )
@@ -0,0 +1,85 @@
+package overdue
+
+import (
+	"net/http"
+	"projects/internal/database/milestone"
+	"projects/internal/database/stage"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewOverdueHandler)
+
+type OverdueHandler interface {
+	GetOverdue(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type overdueHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewOverdueHandler(params Params) OverdueHandler {
+	return &overdueHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+func (p overdueHandler) GetOverdue(c *gin.Context) {
+	var projectID int64
+	if v := c.Query("project_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			p.log.Warnln("Param err: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong project id"})
+			return
+		}
+		projectID = id
+	}
+
+	resp := models.Overdue{Milestones: []models.Milestone{}, Stages: []models.Stage{}}
+	for _, m := range milestone.New(p.db.GetDB()).GetOverdue(projectID) {
+		resp.Milestones = append(resp.Milestones, models.Milestone{
+			MilestoneID: m.MilestoneID,
+			ProjectID:   m.ProjectID,
+			StageID:     m.StageID,
+			Order:       m.Order,
+			Status:      m.Status.String(),
+			DateStart:   m.DateStart,
+			DateEnd:     m.DateStop,
+			Description: m.Description,
+			Title:       m.Title,
+			AssignID:    m.AssignID,
+			ProcessID:   m.ProcessID,
+			Overdue:     m.Overdue,
+		})
+	}
+	for _, st := range stage.New(p.db.GetDB()).GetOverdue(projectID) {
+		resp.Stages = append(resp.Stages, models.Stage{
+			StageID:      st.StageID,
+			Order:        st.Order,
+			Title:        st.Title,
+			DateStart:    st.DateStart,
+			Description:  st.Description,
+			DateEnd:      st.DateStop,
+			ActionPlanID: st.ActionPlanID,
+			WorkspaceID:  st.WorkspaceID,
+			ProjectID:    st.ProjectID,
+			Overdue:      st.Overdue,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -1,11 +1,15 @@
 package processes
 
 import (
+	"errors"
 	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/milestone"
 	"projects/internal/database/processes"
 	"projects/internal/models"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -15,16 +19,23 @@ import (
 
 var Module = fx.Provide(NewProcessesHandler)
 
+const maxLinkMilestones = 500
+
 type ProcessesHandler interface {
 	CreateProcess(c *gin.Context)
 	ReadProcesses(c *gin.Context)
+	GetProcess(c *gin.Context)
 	UpdateProcess(c *gin.Context)
 	DeleteProcess(c *gin.Context)
+	SetStandard(c *gin.Context)
+	LinkMilestones(c *gin.Context)
+	UnlinkMilestones(c *gin.Context)
 }
 
 type Params struct {
 	fx.In
 	db.DbInter
+	events.Bus
 	*config.Tuner
 	*logrus.Logger
 }
@@ -33,10 +44,11 @@ type processesHandler struct {
 	db   db.DbInter
 	log  *logrus.Logger
 	conf *config.Tuner
+	bus  events.Bus
 }
 
 func NewProcessesHandler(params Params) ProcessesHandler {
-	return &processesHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+	return &processesHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner}
 }
 
 func (p processesHandler) CreateProcess(c *gin.Context) {
@@ -46,26 +58,37 @@ func (p processesHandler) CreateProcess(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	if proc.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
 
 	ps := processes.New(p.db.GetDB())
-	procEntity := processes.ProcessEntity{
-		Name: proc.Name,
-	}
+	procEntity := processes.ProcessEntity{Name: proc.Name, Active: true}
+	merge(&procEntity, proc)
 	if err := ps.Create(&procEntity); err != nil {
 		p.log.Warnln("Param err: ", err.Error())
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, &models.ProcessResp{
-		ProcessID: procEntity.ProcessID,
-		Name:      procEntity.Name,
-	})
+	c.JSON(http.StatusOK, processResp(procEntity))
 }
 
+// ReadProcesses lists the catalog, optionally filtered by category, owner_team
+// and active.
 func (p processesHandler) ReadProcesses(c *gin.Context) {
+	filter := processes.Filter{Category: c.Query("category"), OwnerTeam: c.Query("owner_team")}
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return
+		}
+		filter.Active = &active
+	}
 	ps := processes.New(p.db.GetDB())
-	procs, err := ps.GetAll()
+	procs, err := ps.Find(filter)
 	if err != nil {
 		p.log.Warnln("Get processes err", err.Error())
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
@@ -73,15 +96,39 @@ func (p processesHandler) ReadProcesses(c *gin.Context) {
 	}
 	var procResp []models.ProcessResp
 	for _, proc := range procs {
-		procResp = append(procResp, models.ProcessResp{
-			ProcessID: proc.ProcessID,
-			Name:      proc.Name,
-		})
+		procResp = append(procResp, processResp(proc))
 	}
 
 	c.JSON(http.StatusOK, procResp)
 }
 
+// GetProcess returns the process with its standard epics and tasks.
+func (p processesHandler) GetProcess(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	ps := processes.New(p.db.GetDB())
+	proc, err := ps.GetByID(id)
+	if err != nil {
+		p.fail(c, "get process err: ", err)
+		return
+	}
+	epics, tasks, err := ps.GetStandard(id)
+	if err != nil {
+		p.log.Warnln("get standard err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := processResp(proc)
+	resp.Standard = standardResp(epics, tasks)
+	c.JSON(http.StatusOK, resp)
+}
+
 func (p processesHandler) UpdateProcess(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -97,10 +144,15 @@ func (p processesHandler) UpdateProcess(c *gin.Context) {
 		return
 	}
 	ps := processes.New(p.db.GetDB())
-	proc := processes.ProcessEntity{
-		ProcessID: id,
-		Name:      procReq.Name,
+	proc, err := ps.GetByID(id)
+	if err != nil {
+		p.fail(c, "get process err: ", err)
+		return
 	}
+	if procReq.Name != "" {
+		proc.Name = procReq.Name
+	}
+	merge(&proc, procReq)
 	if err := ps.Update(&proc); err != nil {
 		p.log.Warnln("process update err: ", err.Error())
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
@@ -108,10 +160,7 @@ func (p processesHandler) UpdateProcess(c *gin.Context) {
 
 	}
 
-	c.JSON(http.StatusOK, models.ProcessResp{
-		ProcessID: proc.ProcessID,
-		Name:      proc.Name,
-	})
+	c.JSON(http.StatusOK, processResp(proc))
 }
 
 func (p processesHandler) DeleteProcess(c *gin.Context) {
@@ -131,3 +180,178 @@ func (p processesHandler) DeleteProcess(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"result": "success"})
 }
+
+// SetStandard replaces the standard epics and tasks of the process. Milestones
+// linked before keep what was generated for them.
+func (p processesHandler) SetStandard(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var req models.ProcessStandard
+	if err := c.ShouldBindJSON(&req); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+
+	var epics []processes.StandardEpicEntity
+	for _, e := range req.Epics {
+		if e.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "epic title is required"})
+			return
+		}
+		epic := processes.StandardEpicEntity{Title: e.Title, Description: e.Description, Order: e.Order}
+		for _, t := range e.Tasks {
+			if t.Title == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "task title is required"})
+				return
+			}
+			epic.Tasks = append(epic.Tasks, processes.StandardTaskEntity{Title: t.Title, Description: t.Description, Order: t.Order})
+		}
+		epics = append(epics, epic)
+	}
+	var tasks []processes.StandardTaskEntity
+	for _, t := range req.Tasks {
+		if t.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "task title is required"})
+			return
+		}
+		tasks = append(tasks, processes.StandardTaskEntity{Title: t.Title, Description: t.Description, Order: t.Order})
+	}
+
+	ps := processes.New(p.db.GetDB())
+	if err := ps.ReplaceStandard(id, epics, tasks); err != nil {
+		p.fail(c, "set standard err: ", err)
+		return
+	}
+	epics, tasks, err = ps.GetStandard(id)
+	if err != nil {
+		p.log.Warnln("get standard err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, standardResp(epics, tasks))
+}
+
+// LinkMilestones assigns the process to the milestones. Milestones that weren't
+// linked to it before get the standard epics and tasks of the process.
+func (p processesHandler) LinkMilestones(c *gin.Context) {
+	id, req, ok := p.linkRequest(c)
+	if !ok {
+		return
+	}
+
+	linked, err := processes.New(p.db.GetDB()).Link(id, req.MilestoneIDs)
+	if err != nil {
+		p.fail(c, "link milestones err: ", err)
+		return
+	}
+	ml := milestone.New(p.db.GetDB())
+	for _, milestoneID := range linked {
+		p.bus.PublishAs(events.MilestoneProcessLinked, ml.GetMilestoneByID(milestoneID), access.Caller(c))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"linked": linked})
+}
+
+func (p processesHandler) UnlinkMilestones(c *gin.Context) {
+	id, req, ok := p.linkRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := processes.New(p.db.GetDB()).Unlink(id, req.MilestoneIDs); err != nil {
+		p.log.Warnln("unlink milestones err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p processesHandler) linkRequest(c *gin.Context) (int64, models.ProcessLinkReq, bool) {
+	var req models.ProcessLinkReq
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return 0, req, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return 0, req, false
+	}
+	if len(req.MilestoneIDs) == 0 || len(req.MilestoneIDs) > maxLinkMilestones {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "milestone_ids must have 1 to 500 ids"})
+		return 0, req, false
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestones(c, req.MilestoneIDs) {
+		return 0, req, false
+	}
+	return id, req, true
+}
+
+func (p processesHandler) fail(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, processes.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, processes.ErrInactive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		p.log.Warnln(msg, err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+func merge(proc *processes.ProcessEntity, req models.ProcessReq) {
+	if req.Description != nil {
+		proc.Description = *req.Description
+	}
+	if req.Category != nil {
+		proc.Category = *req.Category
+	}
+	if req.OwnerTeam != nil {
+		proc.OwnerTeam = *req.OwnerTeam
+	}
+	if req.Active != nil {
+		proc.Active = *req.Active
+	}
+}
+
+func processResp(proc processes.ProcessEntity) models.ProcessResp {
+	return models.ProcessResp{
+		ProcessID:   proc.ProcessID,
+		Name:        proc.Name,
+		Description: proc.Description,
+		Category:    proc.Category,
+		OwnerTeam:   proc.OwnerTeam,
+		Active:      proc.Active,
+	}
+}
+
+func standardResp(epics []processes.StandardEpicEntity, tasks []processes.StandardTaskEntity) *models.ProcessStandard {
+	resp := &models.ProcessStandard{Epics: []models.StandardEpic{}, Tasks: standardTasks(tasks)}
+	for _, e := range epics {
+		resp.Epics = append(resp.Epics, models.StandardEpic{
+			ID:          e.ID,
+			Title:       e.Title,
+			Description: e.Description,
+			Order:       e.Order,
+			Tasks:       standardTasks(e.Tasks),
+		})
+	}
+	return resp
+}
+
+func standardTasks(tasks []processes.StandardTaskEntity) []models.StandardTask {
+	resp := []models.StandardTask{}
+	for _, t := range tasks {
+		resp = append(resp, models.StandardTask{ID: t.ID, Title: t.Title, Description: t.Description, Order: t.Order})
+	}
+	return resp
+}
@@ -2,12 +2,15 @@ package project
 
 import (
 	"net/http"
+	"projects/internal/access"
 	"projects/internal/database/actionPlan"
+	"projects/internal/database/membership"
 	"projects/internal/database/milestone"
 	"projects/internal/database/projects"
 	"projects/internal/database/stage"
 	"projects/internal/database/workspace"
 	"projects/internal/models"
+	"projects/internal/progress"
 	"projects/pkg/db"
 	"strconv"
 
@@ -54,6 +57,7 @@ func (p projectHandler) GetProjects(c *gin.Context) {
 		Cluster: filterReq.Cluster,
 		Type:    filterReq.Type,
 		Stage:   filterReq.Stage,
+		TagIDs:  filterReq.TagIDs,
 	}
 
 	proj, err := pr.GetAll(filter)
@@ -62,6 +66,12 @@ func (p projectHandler) GetProjects(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	var projectIDs []int64
+	for _, v := range proj {
+		projectIDs = append(projectIDs, v.ProjectID)
+	}
+	projectsProgress := progress.Projects(milestone.New(p.db.GetDB()).GetByProjectIDs(projectIDs))
+
 	projectsResp := []models.ProjectResp{}
 	for _, v := range proj {
 		var phases []models.Phase
@@ -87,6 +97,7 @@ func (p projectHandler) GetProjects(c *gin.Context) {
 			Category:      v.Category.String(),
 			Created:       v.Created,
 			Priority:      v.Priority,
+			Progress:      projectsProgress[v.ProjectID],
 		}
 		projectsResp = append(projectsResp, projectResp)
 	}
@@ -148,6 +159,9 @@ func (p projectHandler) UpdateProject(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).Project(c, id, membership.Editor) {
+		return
+	}
 
 	var projectReq models.ProjectReq
 	if err := c.ShouldBindJSON(&projectReq); err != nil {
@@ -297,18 +311,48 @@ func (p projectHandler) CreateProject(c *gin.Context) {
 	}
 
 	w := workspace.New(tr)
-	workSpaceEntity := workspace.WorkspaceEntity{
-		ProjectID: proj.ProjectID,
-		Type:      workspace.Legal,
-		Title:     "main",
+	workspaces := []workspace.WorkspaceEntity{{Type: workspace.Legal, Title: "main"}}
+	if len(projectReq.Workspaces) > 0 {
+		workspaces = workspaces[:0]
+		for _, wsReq := range projectReq.Workspaces {
+			ws := workspace.WorkspaceEntity{Type: workspace.Legal, Title: "main"}
+			if wsReq.Type != nil {
+				if ws.Type, err = workspace.ParseType(*wsReq.Type); err != nil {
+					tr.Rollback()
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			if wsReq.Title != nil && *wsReq.Title != "" {
+				ws.Title = *wsReq.Title
+			}
+			workspaces = append(workspaces, ws)
+		}
 	}
-	err = w.Create(&workSpaceEntity)
-	if err != nil {
-		tr.Rollback()
-		p.log.Warnln("Create workspace err: ", err.Error())
-		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
-		return
+	creator := access.UserID(c)
+	for i := range workspaces {
+		workspaces[i].ProjectID = proj.ProjectID
+		if err := w.Create(&workspaces[i]); err != nil {
+			tr.Rollback()
+			p.log.Warnln("Create workspace err: ", err.Error())
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		if creator == "" {
+			continue
+		}
+		if err := membership.New(tr).Set(&membership.MemberEntity{
+			WorkspaceID: workspaces[i].WorkspaceID,
+			UserID:      creator,
+			Role:        membership.Admin,
+		}); err != nil {
+			tr.Rollback()
+			p.log.Warnln("Add workspace admin err: ", err.Error())
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
 	}
+	workSpaceEntity := workspaces[0]
 	aP := actionPlan.New(tr)
 	actionPlanEntity := actionPlan.ActionPlanEntity{
 		ProjectID:   proj.ProjectID,
@@ -389,6 +433,14 @@ func (p projectHandler) CreateProject(c *gin.Context) {
 		Priority:      proj.Priority,
 		Template:      &models.ProjectTemplate{Stage: stageResp},
 	}
+	for _, ws := range workspaces {
+		projectsResp.Workspaces = append(projectsResp.Workspaces, models.Workspace{
+			WorkspaceID: ws.WorkspaceID,
+			ProjectID:   ws.ProjectID,
+			Type:        ws.Type.String(),
+			Title:       ws.Title,
+		})
+	}
 
 	c.JSON(http.StatusOK, projectsResp)
 }
@@ -405,6 +457,9 @@ func (p projectHandler) DeleteProject(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "wrong id"})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).Project(ctx, id, membership.Admin) {
+		return
+	}
 
 	if err := project.Delete(id); err != nil {
 		p.log.Warnln("Can't delete project with err: ", err.Error())
@@ -0,0 +1,234 @@
+package reports
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"projects/internal/database/processes"
+	"projects/internal/database/projects"
+	"projects/internal/database/reports"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewReportsHandler)
+
+const (
+	defaultSlowest = 5
+	maxSlowest     = 50
+	secondsPerDay  = 24 * 60 * 60
+)
+
+var projectTypes = map[string]bool{
+	string(projects.VentureBuilding): true,
+	string(projects.ServiceDevt):     true,
+	string(projects.ServiceVB):       true,
+	string(projects.Social):          true,
+	string(projects.Internal):        true,
+}
+
+type ReportsHandler interface {
+	GetProcessReports(c *gin.Context)
+	GetProcessReport(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type reportsHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewReportsHandler(params Params) ReportsHandler {
+	return &reportsHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+// GetProcessReports aggregates the milestones of every process across all
+// projects. Query: cluster, region, type and slowest (projects per process).
+func (p reportsHandler) GetProcessReports(c *gin.Context) {
+	filter, slowest, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	procs, err := processes.New(p.db.GetDB()).GetAll()
+	if err != nil {
+		p.log.Warnln("get processes err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := p.build(procs, filter, slowest)
+	if err != nil {
+		p.log.Warnln("process report err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetProcessReport is GetProcessReports for a single process.
+func (p reportsHandler) GetProcessReport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong process id"})
+		return
+	}
+	filter, slowest, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	proc, err := processes.New(p.db.GetDB()).GetByID(id)
+	if err != nil {
+		if errors.Is(err, processes.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		p.log.Warnln("get process err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	filter.ProcessID = id
+	resp, err := p.build([]processes.ProcessEntity{proc}, filter, slowest)
+	if err != nil {
+		p.log.Warnln("process report err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp[0])
+}
+
+func (p reportsHandler) build(procs []processes.ProcessEntity, filter reports.Filter, slowest int) ([]models.ProcessReport, error) {
+	repo := reports.New(p.db.GetDB())
+	counts, err := repo.StatusCounts(filter)
+	if err != nil {
+		return nil, err
+	}
+	cycles, err := repo.Cycles(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*models.ProcessReport, len(procs))
+	resp := make([]models.ProcessReport, len(procs))
+	for i, proc := range procs {
+		resp[i] = models.ProcessReport{
+			ProcessID:       proc.ProcessID,
+			Name:            proc.Name,
+			Category:        proc.Category,
+			OwnerTeam:       proc.OwnerTeam,
+			ByStatus:        map[string]int{},
+			SlowestProjects: []models.ProjectCycle{},
+		}
+		byID[proc.ProcessID] = &resp[i]
+	}
+	for _, cnt := range counts {
+		r, ok := byID[cnt.ProcessID]
+		if !ok {
+			continue
+		}
+		r.Milestones += cnt.Count
+		r.Overdue += cnt.Overdue
+		r.ByStatus[cnt.Status.String()] += cnt.Count
+	}
+
+	type sum struct {
+		seconds int64
+		count   int
+	}
+	processSums := make(map[int64]*sum)
+	projectSums := make(map[int64]map[int64]*sum)
+	for _, cy := range cycles {
+		if _, ok := byID[cy.ProcessID]; !ok {
+			continue
+		}
+		if processSums[cy.ProcessID] == nil {
+			processSums[cy.ProcessID] = &sum{}
+			projectSums[cy.ProcessID] = make(map[int64]*sum)
+		}
+		if projectSums[cy.ProcessID][cy.ProjectID] == nil {
+			projectSums[cy.ProcessID][cy.ProjectID] = &sum{}
+		}
+		for _, s := range []*sum{processSums[cy.ProcessID], projectSums[cy.ProcessID][cy.ProjectID]} {
+			s.seconds += cy.Finished - cy.Started
+			s.count++
+		}
+	}
+
+	var projectIDs []int64
+	for processID, s := range processSums {
+		r := byID[processID]
+		r.Measured = s.count
+		r.AvgCycleDays = days(s.seconds, s.count)
+		for projectID, ps := range projectSums[processID] {
+			r.SlowestProjects = append(r.SlowestProjects, models.ProjectCycle{
+				ProjectID:    projectID,
+				Measured:     ps.count,
+				AvgCycleDays: days(ps.seconds, ps.count),
+			})
+		}
+		sort.Slice(r.SlowestProjects, func(i, j int) bool {
+			a, b := r.SlowestProjects[i], r.SlowestProjects[j]
+			if a.AvgCycleDays != b.AvgCycleDays {
+				return a.AvgCycleDays > b.AvgCycleDays
+			}
+			return a.ProjectID < b.ProjectID
+		})
+		if len(r.SlowestProjects) > slowest {
+			r.SlowestProjects = r.SlowestProjects[:slowest]
+		}
+		for _, pc := range r.SlowestProjects {
+			projectIDs = append(projectIDs, pc.ProjectID)
+		}
+	}
+
+	titles, err := repo.ProjectTitles(projectIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp {
+		for j := range resp[i].SlowestProjects {
+			resp[i].SlowestProjects[j].Title = titles[resp[i].SlowestProjects[j].ProjectID]
+		}
+	}
+	return resp, nil
+}
+
+func parseFilter(c *gin.Context) (reports.Filter, int, error) {
+	filter := reports.Filter{Cluster: c.Query("cluster"), Region: c.Query("region"), Type: c.Query("type")}
+	if filter.Type != "" && !projectTypes[filter.Type] {
+		return filter, 0, errors.New("unknown project type")
+	}
+	slowest := defaultSlowest
+	if v := c.Query("slowest"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxSlowest {
+			return filter, 0, errors.New("slowest must be between 0 and 50")
+		}
+		slowest = n
+	}
+	return filter, slowest, nil
+}
+
+func days(seconds int64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(float64(seconds)/float64(count)/secondsPerDay*10) / 10
+}
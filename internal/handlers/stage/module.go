@@ -2,6 +2,7 @@ package stage
 
 import (
 	"net/http"
+	"projects/internal/access"
 	"projects/internal/database/stage"
 	"projects/internal/models"
 	"projects/pkg/config"
@@ -46,6 +47,17 @@ func (p stageHandler) CreateStage(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	checker := access.New(p.db.GetDB(), p.log)
+	checked := make(map[int64]bool)
+	for _, st := range stagesReq.Stage {
+		if checked[st.ActionPlanID] {
+			continue
+		}
+		if !checker.EditActionPlan(c, st.ActionPlanID) {
+			return
+		}
+		checked[st.ActionPlanID] = true
+	}
 	var stages []stage.StageEntity
 	for _, st := range stagesReq.Stage {
 		stages = append(stages, stage.StageEntity{
@@ -94,6 +106,13 @@ func (p stageHandler) UpdateStage(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditStage(c, id) {
+		return
+	}
+	if stageReq.ActionPlanID > 0 && !checker.EditActionPlan(c, stageReq.ActionPlanID) {
+		return
+	}
 
 	s := stage.New(p.db.GetDB())
 	stageUpdated, err := s.Update(stage.StageEntity{
@@ -191,6 +210,9 @@ func (p stageHandler) DeleteStage(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).EditStage(c, id) {
+		return
+	}
 
 	s := stage.New(p.db.GetDB())
 	if err := s.DeleteStage(id); err != nil {
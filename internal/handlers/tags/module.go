@@ -0,0 +1,311 @@
+package tags
+
+import (
+	"errors"
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/membership"
+	"projects/internal/database/tags"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+var Module = fx.Provide(NewTagsHandler)
+
+type TagsHandler interface {
+	GetTags(c *gin.Context)
+	CreateTag(c *gin.Context)
+	UpdateTag(c *gin.Context)
+	DeleteTag(c *gin.Context)
+	LinkTag(c *gin.Context)
+	UnlinkTag(c *gin.Context)
+	GetEntityTags(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type tagsHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewTagsHandler(params Params) TagsHandler {
+	return &tagsHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+func validEntityType(entityType string) bool {
+	switch entityType {
+	case tags.Project, tags.Milestone, tags.Epic:
+		return true
+	}
+	return false
+}
+
+// editAllowed checks the caller may edit the tagged entity.
+func (p tagsHandler) editAllowed(c *gin.Context, entityType string, id int64) bool {
+	checker := access.New(p.db.GetDB(), p.log)
+	switch entityType {
+	case tags.Project:
+		return checker.Project(c, id, membership.Editor)
+	case tags.Milestone:
+		return checker.EditMilestone(c, id)
+	}
+	return checker.EditEpic(c, id)
+}
+
+// ownTag loads a tag of the caller's company, tags of other companies are not
+// found.
+func (p tagsHandler) ownTag(c *gin.Context, id int64) (tags.TagEntity, bool) {
+	tag, err := tags.New(p.db.GetDB()).Get(id)
+	if err == nil && tag.CompanyID != access.Company(c) {
+		err = gorm.ErrRecordNotFound
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+		return tag, false
+	}
+	if err != nil {
+		p.log.Warnln("get tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return tag, false
+	}
+	return tag, true
+}
+
+func tagResp(tag tags.TagEntity, usage map[string]int64) models.Tag {
+	resp := models.Tag{
+		TagID:     tag.TagID,
+		CompanyID: tag.CompanyID,
+		Name:      tag.Name,
+		Color:     tag.Color,
+		Usage:     usage,
+	}
+	for _, count := range usage {
+		resp.Total += count
+	}
+	return resp
+}
+
+// GetTags lists the tags of the caller's company.
+func (p tagsHandler) GetTags(c *gin.Context) {
+	repo := tags.New(p.db.GetDB())
+	tagEntities, err := repo.GetByCompany(access.Company(c))
+	if err != nil {
+		p.log.Warnln("get tags err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var ids []int64
+	for _, t := range tagEntities {
+		ids = append(ids, t.TagID)
+	}
+	usage, err := repo.Usage(ids)
+	if err != nil {
+		p.log.Warnln("tag usage err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := []models.Tag{}
+	for _, t := range tagEntities {
+		resp = append(resp, tagResp(t, usage[t.TagID]))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p tagsHandler) CreateTag(c *gin.Context) {
+	var tagReq models.TagReq
+	if err := c.ShouldBindJSON(&tagReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if tagReq.Name == nil || *tagReq.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	tag := tags.TagEntity{CompanyID: access.Company(c), Name: *tagReq.Name}
+	if tagReq.Color != nil {
+		tag.Color = *tagReq.Color
+	}
+	if err := tags.New(p.db.GetDB()).Create(&tag); err != nil {
+		p.log.Warnln("create tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tagResp(tag, nil))
+}
+
+func (p tagsHandler) UpdateTag(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var tagReq models.TagReq
+	if err := c.ShouldBindJSON(&tagReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+
+	updateColumns := make(map[string]interface{})
+	if tagReq.Name != nil {
+		if *tagReq.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be empty"})
+			return
+		}
+		updateColumns["name"] = *tagReq.Name
+	}
+	if tagReq.Color != nil {
+		updateColumns["color"] = *tagReq.Color
+	}
+	if _, ok := p.ownTag(c, id); !ok {
+		return
+	}
+	repo := tags.New(p.db.GetDB())
+	tag, err := repo.Update(id, updateColumns)
+	if err != nil {
+		p.log.Warnln("update tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	usage, err := repo.Usage([]int64{id})
+	if err != nil {
+		p.log.Warnln("tag usage err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tagResp(tag, usage[id]))
+}
+
+func (p tagsHandler) DeleteTag(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := p.ownTag(c, id); !ok {
+		return
+	}
+
+	if err := tags.New(p.db.GetDB()).Delete(id); err != nil {
+		p.log.Warnln("delete tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p tagsHandler) LinkTag(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var linkReq models.TagLinkReq
+	if err := c.ShouldBindJSON(&linkReq); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if !validEntityType(linkReq.EntityType) || linkReq.EntityID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entity"})
+		return
+	}
+	if !p.editAllowed(c, linkReq.EntityType, linkReq.EntityID) {
+		return
+	}
+
+	if _, ok := p.ownTag(c, id); !ok {
+		return
+	}
+	if err := tags.New(p.db.GetDB()).Link(id, linkReq.EntityType, linkReq.EntityID); err != nil {
+		p.log.Warnln("link tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p tagsHandler) UnlinkTag(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var linkReq models.TagLinkReq
+	if err := c.BindQuery(&linkReq); err != nil {
+		p.log.Warnln("bind err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if !validEntityType(linkReq.EntityType) || linkReq.EntityID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entity"})
+		return
+	}
+	if !p.editAllowed(c, linkReq.EntityType, linkReq.EntityID) {
+		return
+	}
+	if _, ok := p.ownTag(c, id); !ok {
+		return
+	}
+
+	if err := tags.New(p.db.GetDB()).Unlink(id, linkReq.EntityType, linkReq.EntityID); err != nil {
+		p.log.Warnln("unlink tag err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p tagsHandler) GetEntityTags(c *gin.Context) {
+	entityType := c.Param("type")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if !validEntityType(entityType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entity type"})
+		return
+	}
+
+	tagEntities, err := tags.New(p.db.GetDB()).GetByEntity(access.Company(c), entityType, id)
+	if err != nil {
+		p.log.Warnln("get entity tags err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.Tag{}
+	for _, t := range tagEntities {
+		resp = append(resp, tagResp(t, nil))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
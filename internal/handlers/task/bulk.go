@@ -0,0 +1,170 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/epics"
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/dispatcher"
+	"projects/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBulkTasks    = 200
+	bulkConcurrency = 8
+
+	bulkCreated = "created"
+	bulkUpdated = "updated"
+	bulkPending = "pending"
+	bulkFailed  = "failed"
+)
+
+// BulkTasks creates and updates many tasks of one milestone or epic, updated
+// tasks have to be in that milestone already. Local updates and the outbox
+// entries are written in one transaction, the task service calls run
+// concurrently and the new task_entities rows are stored together afterwards.
+// Items the task service could not take yet are left to the outbox worker and
+// reported as pending.
+func (p taskHandler) BulkTasks(c *gin.Context) {
+	var bulkReq models.TaskBulk
+	if err := c.ShouldBindJSON(&bulkReq); err != nil {
+		p.log.Warn("bind err", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(bulkReq.Items) == 0 || len(bulkReq.Items) > maxBulkTasks {
+		c.JSON(http.StatusBadRequest, "items must hold 1 to 200 tasks")
+		return
+	}
+	if bulkReq.EpicID > 0 {
+		epic, err := epics.NewEpic(p.db.GetDB()).GetEpicByID(bulkReq.EpicID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, "epic not found")
+			return
+		}
+		if bulkReq.MilestoneID > 0 && bulkReq.MilestoneID != epic.MilestoneID {
+			c.JSON(http.StatusBadRequest, "epic belongs to another milestone")
+			return
+		}
+		bulkReq.MilestoneID = epic.MilestoneID
+	}
+	mile := milestone.New(p.db.GetDB()).GetMilestoneByID(bulkReq.MilestoneID)
+	if mile.MilestoneID == 0 {
+		c.JSON(http.StatusBadRequest, "milestone not found")
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, mile.MilestoneID) {
+		return
+	}
+
+	result := models.TaskBulkResult{MilestoneID: mile.MilestoneID, EpicID: bulkReq.EpicID, Results: make([]models.TaskBulkItemResult, len(bulkReq.Items))}
+	var entries []outbox.EntryEntity
+	var entryItems []int
+	var entryEpics []int64
+	err := p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var updateIDs []int64
+		for _, item := range bulkReq.Items {
+			if item.ID > 0 {
+				updateIDs = append(updateIDs, item.ID)
+			}
+		}
+		known, err := tasks.New(tx).GetByIDs(updateIDs)
+		if err != nil {
+			return err
+		}
+		exists := make(map[int64]tasks.TaskEntity, len(known))
+		for _, t := range known {
+			exists[t.ID] = t
+		}
+
+		for i, item := range bulkReq.Items {
+			result.Results[i] = models.TaskBulkItemResult{Index: i, TaskID: item.ID}
+			previous, found := exists[item.ID]
+			if item.ID > 0 && !found {
+				result.Results[i].Status = bulkFailed
+				result.Results[i].Error = "task not found"
+				continue
+			}
+			if item.ID > 0 && previous.MilestoneID != mile.MilestoneID {
+				result.Results[i].Status = bulkFailed
+				result.Results[i].Error = "task belongs to another milestone"
+				continue
+			}
+			req := item.TaskReq
+			req.MilestoneID = mile.MilestoneID
+			req.EpicID = bulkReq.EpicID
+			if bulkReq.EpicID == 0 {
+				// a milestone level bulk keeps the epics of existing tasks
+				req.EpicID = previous.EpicID
+			}
+			payload, err := json.Marshal(req)
+			if err != nil {
+				return err
+			}
+			entry := outbox.EntryEntity{Op: outbox.OpCreate, TaskID: item.ID, Payload: string(payload), UserID: access.UserID(c), CompanyID: access.Company(c)}
+			if item.ID > 0 {
+				entry.Op = outbox.OpUpdate
+				raw, err := json.Marshal(previous)
+				if err != nil {
+					return err
+				}
+				entry.Previous = string(raw)
+				if err := tasks.New(tx).UpdateTask(&tasks.TaskEntity{
+					ID:           item.ID,
+					MilestoneID:  mile.MilestoneID,
+					EpicID:       bulkReq.EpicID,
+					ActionPlanID: mile.ActionPlanID,
+				}); err != nil {
+					return err
+				}
+			}
+			entries = append(entries, entry)
+			entryItems = append(entryItems, i)
+			entryEpics = append(entryEpics, req.EpicID)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return outbox.New(tx).AddBatch(entries)
+	})
+	if err != nil {
+		p.log.Warn("bulk tasks err", err)
+		c.JSON(http.StatusBadGateway, err.Error())
+		return
+	}
+
+	ctx := access.TaskContext(c)
+	outcomes := p.dispatcher().DispatchBatch(ctx, entries, bulkConcurrency)
+	for k, o := range outcomes {
+		item := &result.Results[entryItems[k]]
+		item.OutboxID = o.Entry.ID
+		switch {
+		case errors.Is(o.Err, dispatcher.ErrPending):
+			item.Status = bulkPending
+			item.Error = o.Err.Error()
+		case o.Err != nil:
+			item.Status = bulkFailed
+			item.Error = o.Err.Error()
+		default:
+			item.Status = bulkUpdated
+			if o.Entry.Op == outbox.OpCreate {
+				item.Status = bulkCreated
+			}
+			task := o.Task
+			task.MilestoneId = mile.MilestoneID
+			task.EpicID = entryEpics[k]
+			task.ActionPlanID = mile.ActionPlanID
+			item.TaskID = task.ID
+			item.Task = &task
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
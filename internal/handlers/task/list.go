@@ -0,0 +1,209 @@
+package task
+
+import (
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+	"projects/pkg/dates"
+	"projects/pkg/taskclient"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+
+	// batchSize caps the task ids of one task service batch call.
+	batchSize = 200
+)
+
+// taskLess compares two tasks by a sortable field of the listing.
+var taskLess = map[string]func(a, b models.Task) bool{
+	"id":         func(a, b models.Task) bool { return a.ID < b.ID },
+	"title":      func(a, b models.Task) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+	"status":     func(a, b models.Task) bool { return a.Status < b.Status },
+	"priority":   func(a, b models.Task) bool { return a.Priority < b.Priority },
+	"start_time": func(a, b models.Task) bool { return dateLess(a.StartTime, b.StartTime) },
+	"end_time":   func(a, b models.Task) bool { return dateLess(a.EndTime, b.EndTime) },
+}
+
+// GetTasks lists the tasks of a project, action plan, stage, milestone or epic.
+// Assignee, status, priority and due date filters and sorting by payload
+// fields apply to the task payloads, so the page is cut after filtering and
+// sorting. Without them the page is read from task_entities.
+func (p taskHandler) GetTasks(c *gin.Context) {
+	var filter models.TaskFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		p.log.Warn("bind err", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	scope := tasks.Filter{
+		ProjectID:    filter.ProjectID,
+		ActionPlanID: filter.ActionPlanID,
+		StageID:      filter.StageID,
+		MilestoneID:  filter.MilestoneID,
+		EpicID:       filter.EpicID,
+	}
+	if scope.Empty() {
+		c.JSON(http.StatusBadRequest, "one of project_id, action_plan_id, stage_id, milestone_id or epic_id is required")
+		return
+	}
+	less, ok := taskLess[filter.Sort]
+	if filter.Sort == "" {
+		less, ok = taskLess["id"], true
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, "wrong sort")
+		return
+	}
+	if filter.Order != "" && filter.Order != "asc" && filter.Order != "desc" {
+		c.JSON(http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+	dueFrom, dueTo, ok := dueRange(filter.DueFrom, filter.DueTo)
+	if !ok {
+		c.JSON(http.StatusBadRequest, "wrong due date")
+		return
+	}
+
+	page, perPage := filter.Page, filter.PerPage
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	paged := (filter.Sort == "" || filter.Sort == "id") && filter.AssigneeID == "" &&
+		filter.Status == "" && filter.Priority == "" && filter.DueFrom == "" && filter.DueTo == ""
+
+	var taskEntities []tasks.TaskEntity
+	var total int64
+	var err error
+	if paged {
+		taskEntities, total, err = tasks.New(p.db.GetDB()).FindPage(scope, filter.Order == "desc", (page-1)*perPage, perPage)
+	} else {
+		taskEntities, err = tasks.New(p.db.GetDB()).Find(scope)
+	}
+	if err != nil {
+		p.log.Warn("can't find tasks", err)
+		c.JSON(http.StatusBadGateway, "can' get task")
+		return
+	}
+	local := make(map[int64]tasks.TaskEntity, len(taskEntities))
+	for _, t := range taskEntities {
+		local[t.ID] = t
+	}
+	ctx := access.TaskContext(c)
+	var remote []models.Task
+	for i := 0; i < len(taskEntities); i += batchSize {
+		end := i + batchSize
+		if end > len(taskEntities) {
+			end = len(taskEntities)
+		}
+		ids := make([]int64, 0, end-i)
+		for _, t := range taskEntities[i:end] {
+			ids = append(ids, t.ID)
+		}
+		fetched, err := p.tasks.Batch(ctx, ids)
+		if err != nil {
+			p.log.Warn("task client err", err)
+			c.JSON(taskclient.Status(err), err.Error())
+			return
+		}
+		remote = append(remote, fetched...)
+	}
+
+	items := []models.Task{}
+	for _, v := range remote {
+		t, ok := local[v.ID]
+		if !ok {
+			continue
+		}
+		v.MilestoneId = t.MilestoneID
+		v.EpicID = t.EpicID
+		v.ActionPlanID = t.ActionPlanID
+		if filter.AssigneeID != "" && v.AssigneeId != filter.AssigneeID {
+			continue
+		}
+		if filter.Status != "" && !strings.EqualFold(v.Status, filter.Status) {
+			continue
+		}
+		if filter.Priority != "" && !strings.EqualFold(v.Priority, filter.Priority) {
+			continue
+		}
+		if !inRange(v.EndTime, dueFrom, dueTo) {
+			continue
+		}
+		items = append(items, v)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if filter.Order == "desc" {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+
+	if paged {
+		c.JSON(http.StatusOK, models.TaskList{Items: items, Total: int(total), Page: page, PerPage: perPage})
+		return
+	}
+	resp := models.TaskList{Items: []models.Task{}, Total: len(items), Page: page, PerPage: perPage}
+	if start := (page - 1) * perPage; start < len(items) {
+		end := start + perPage
+		if end > len(items) {
+			end = len(items)
+		}
+		resp.Items = items[start:end]
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// dueRange parses the optional bounds, zero times mean unbounded.
+func dueRange(from, to string) (time.Time, time.Time, bool) {
+	var fromT, toT time.Time
+	var ok bool
+	if from != "" {
+		if fromT, ok = dates.Parse(from); !ok {
+			return fromT, toT, false
+		}
+	}
+	if to != "" {
+		if toT, ok = dates.Parse(to); !ok {
+			return fromT, toT, false
+		}
+	}
+	return fromT, toT, true
+}
+
+// inRange reports whether the date is within the bounds, tasks without a due
+// date only match an unbounded range.
+func inRange(value string, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	d, ok := dates.Parse(value)
+	if !ok {
+		return false
+	}
+	return (from.IsZero() || !d.Before(from)) && (to.IsZero() || !d.After(to))
+}
+
+// dateLess orders by date with tasks without a date last.
+func dateLess(a, b string) bool {
+	da, okA := dates.Parse(a)
+	db, okB := dates.Parse(b)
+	if okA != okB {
+		return okA
+	}
+	return da.Before(db)
+}
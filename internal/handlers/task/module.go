@@ -1,28 +1,31 @@
 package task
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
+	"projects/internal/access"
 	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
 	"projects/internal/database/tasks"
+	"projects/internal/dispatcher"
 	"projects/internal/models"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
+	"gorm.io/gorm"
 )
 
 var Module = fx.Provide(NewTaskHandler)
 
+var errMilestoneNotFound = errors.New("milestone not found")
+
 type TaskHandler interface {
 	GetTaskByMilestone(c *gin.Context)
 	GetTaskByID(c *gin.Context)
@@ -31,47 +34,46 @@ type TaskHandler interface {
 	UpdateTask(c *gin.Context)
 	CreateTask(c *gin.Context)
 	GetTask(c *gin.Context)
-	GetTasksBatch(c *gin.Context)
+	GetTasks(c *gin.Context)
+	ClientMetrics(c *gin.Context)
+	GetOutboxEntry(c *gin.Context)
+	BulkTasks(c *gin.Context)
 }
 
 type Params struct {
 	fx.In
 	db.DbInter
+	events.Bus
 	*config.Tuner
 	*logrus.Logger
+	taskclient.Client
 }
 
 type taskHandler struct {
-	db   db.DbInter
-	log  *logrus.Logger
-	conf *config.Tuner
+	db    db.DbInter
+	log   *logrus.Logger
+	conf  *config.Tuner
+	tasks taskclient.Client
+	bus   events.Bus
 }
 
 func NewTaskHandler(params Params) TaskHandler {
-	return &taskHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+	return &taskHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner, tasks: params.Client}
 }
 
-func (p taskHandler) GetTasksBatch(c *gin.Context) {
-	var resp []models.Task
-
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-
-	if err := p.sendRequest(http.MethodPost, "/tasks/batch", nil, &resp, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+func (p taskHandler) GetTask(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("task_id"), 10, 64)
+	if err != nil {
+		p.log.Warn("wrong id param", err)
+		c.JSON(http.StatusBadRequest, "wrong id")
 		return
 	}
-	c.JSON(http.StatusOK, nil)
-}
-
-func (p taskHandler) GetTask(c *gin.Context) {
-	var resp models.Task
-
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
 
-	if err := p.sendRequest(http.MethodGet, "/tasks/"+c.Param("task_id"), nil, &resp, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+	ctx := access.TaskContext(c)
+	resp, err := p.tasks.Get(ctx, id)
+	if err != nil {
+		p.log.Warn("task client err", err)
+		c.JSON(taskclient.Status(err), err.Error())
 		return
 	}
 	c.JSON(http.StatusOK, resp)
@@ -85,39 +87,31 @@ func (p taskHandler) CreateTask(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	jsonB, err := json.Marshal(task)
-	if err != nil {
-		p.log.Warn("marshal err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+	if milestone.New(p.db.GetDB()).GetMilestoneByID(task.MilestoneID).MilestoneID == 0 {
+		c.JSON(http.StatusBadRequest, "milestone not found")
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).EditMilestone(c, task.MilestoneID) {
 		return
 	}
-	var createdTask models.Task
-	if err := p.sendRequest(http.MethodPost, "/tasks", bytes.NewBuffer(jsonB), &createdTask, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
+	payload, err := json.Marshal(task)
+	if err != nil {
+		p.log.Warn("marshal err", err)
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
-	if createdTask.ID == 0 {
-		p.log.Warn("create Task err")
-		c.JSON(http.StatusBadGateway, "create Task err")
+	// the local row is written by the dispatcher once the task service returned the id
+	entry := outbox.EntryEntity{Op: outbox.OpCreate, Payload: string(payload), UserID: access.UserID(c), CompanyID: access.Company(c)}
+	if err := outbox.New(p.db.GetDB()).Add(&entry); err != nil {
+		p.log.Warn("can't queue task create", err)
+		c.JSON(http.StatusBadGateway, "can't create task")
 		return
 	}
 
-	repo := tasks.New(p.db.GetDB())
-	ml := milestone.New(p.db.GetDB())
-	milestone := ml.GetMilestoneByID(task.MilestoneID)
-	taskEntity, err := repo.CreateTask(tasks.TaskEntity{
-		ID:           createdTask.ID,
-		MilestoneID:  task.MilestoneID,
-		EpicID:       task.EpicID,
-		ActionPlanID: milestone.ActionPlanID,
-	})
-	createdTask.MilestoneId = task.MilestoneID
-	createdTask.EpicID = task.EpicID
-	if err != nil || taskEntity.ID <= 0 {
-		p.log.Warn("can't create task", err)
-		c.JSON(http.StatusBadGateway, "can't create task")
+	ctx := access.TaskContext(c)
+	createdTask, err := p.dispatcher().Dispatch(ctx, entry)
+	if err != nil {
+		p.dispatchFailed(c, entry, err)
 		return
 	}
 
@@ -139,32 +133,63 @@ func (p taskHandler) UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	jsonB, err := json.Marshal(task)
+	checker := access.New(p.db.GetDB(), p.log)
+	if !checker.EditTask(c, ID) {
+		return
+	}
+	if task.MilestoneID > 0 && !checker.EditMilestone(c, task.MilestoneID) {
+		return
+	}
+	payload, err := json.Marshal(task)
 	if err != nil {
 		p.log.Warn("marshal err", err)
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
-	var updatedTask models.Task
-	if err := p.sendRequest(http.MethodPut, "/tasks/"+iDString, bytes.NewBuffer(jsonB), &updatedTask, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+
+	entry := outbox.EntryEntity{Op: outbox.OpUpdate, TaskID: ID, Payload: string(payload), UserID: access.UserID(c), CompanyID: access.Company(c)}
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// the previous row is restored when the task service rejects the change
+		previous, err := dispatcher.Snapshot(tx, ID)
+		if err != nil {
+			return err
+		}
+		entry.Previous = previous
+		local := tasks.TaskEntity{ID: ID, MilestoneID: task.MilestoneID, EpicID: task.EpicID}
+		if task.MilestoneID > 0 {
+			mile := milestone.New(tx).GetMilestoneByID(task.MilestoneID)
+			if mile.MilestoneID == 0 {
+				return errMilestoneNotFound
+			}
+			local.ActionPlanID = mile.ActionPlanID
+		}
+		if err := tasks.New(tx).UpdateTask(&local); err != nil {
+			return err
+		}
+		return outbox.New(tx).Add(&entry)
+	})
+	if errors.Is(err, errMilestoneNotFound) {
+		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-
-	repo := tasks.New(p.db.GetDB())
-	if err := repo.UpdateTask(&tasks.TaskEntity{
-		ID:           ID,
-		MilestoneID:  updatedTask.MilestoneId,
-		EpicID:       updatedTask.EpicID,
-		ActionPlanID: updatedTask.ActionPlanID,
-	}); err != nil {
+	if err != nil {
 		p.log.Warn("update task err", err)
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
 
+	ctx := access.TaskContext(c)
+	updatedTask, err := p.dispatcher().Dispatch(ctx, entry)
+	if err != nil {
+		p.dispatchFailed(c, entry, err)
+		return
+	}
+	if taskEntity, err := tasks.New(p.db.GetDB()).GetTaskByID(ID); err == nil {
+		updatedTask.MilestoneId = taskEntity.MilestoneID
+		updatedTask.EpicID = taskEntity.EpicID
+		updatedTask.ActionPlanID = taskEntity.ActionPlanID
+	}
+
 	c.JSON(http.StatusOK, updatedTask)
 }
 
@@ -180,20 +205,34 @@ func (p taskHandler) DeleteTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, "wrong id")
 		return
 	}
-
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	if err := p.sendRequest(http.MethodDelete, "/tasks/"+fmt.Sprint(id), nil, nil, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+	if !access.New(p.db.GetDB(), p.log).EditTask(c, int64(id)) {
 		return
 	}
-	repo := tasks.New(p.db.GetDB())
-	if err := repo.DeleteTask(int64(id)); err != nil {
+
+	entry := outbox.EntryEntity{Op: outbox.OpDelete, TaskID: int64(id), UserID: access.UserID(c), CompanyID: access.Company(c)}
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		previous, err := dispatcher.Snapshot(tx, int64(id))
+		if err != nil {
+			return err
+		}
+		entry.Previous = previous
+		if err := tasks.New(tx).DeleteTask(int64(id)); err != nil {
+			return err
+		}
+		return outbox.New(tx).Add(&entry)
+	})
+	if err != nil {
 		p.log.Warn("delete task err", err)
 		c.JSON(http.StatusBadGateway, err.Error())
 		return
 	}
 
+	ctx := access.TaskContext(c)
+	if _, err := p.dispatcher().Dispatch(ctx, entry); err != nil {
+		p.dispatchFailed(c, entry, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": "ok"})
 }
 
@@ -217,21 +256,15 @@ func (p taskHandler) GetTaskByEpic(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, "can' get task")
 		return
 	}
-	var response []models.Task
 	var tasksId []int64
 	for _, v := range taskEntities {
 		tasksId = append(tasksId, v.ID)
 	}
-	jsonB, err := json.Marshal(tasksId)
+	ctx := access.TaskContext(c)
+	response, err := p.tasks.Batch(ctx, tasksId)
 	if err != nil {
-		p.log.Warn("marshal err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
-		return
-	}
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	if err := p.sendRequest(http.MethodPost, "/tasks/batch", bytes.NewBuffer([]byte(jsonB)), &response, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+		p.log.Warn("task client err", err)
+		c.JSON(taskclient.Status(err), err.Error())
 		return
 	}
 	var resp []models.Task
@@ -276,12 +309,11 @@ func (p taskHandler) GetTaskByID(c *gin.Context) {
 		return
 	}
 
-	var response []models.Task
-	jsonB, _ := json.Marshal([]int{id})
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	if err := p.sendRequest(http.MethodPost, "/tasks/batch", bytes.NewBuffer([]byte(jsonB)), &response, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+	ctx := access.TaskContext(c)
+	response, err := p.tasks.Batch(ctx, []int64{int64(id)})
+	if err != nil {
+		p.log.Warn("task client err", err)
+		c.JSON(taskclient.Status(err), err.Error())
 		return
 	}
 
@@ -319,21 +351,15 @@ func (p taskHandler) GetTaskByMilestone(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, "can' get task")
 		return
 	}
-	var response []models.Task
 	var tasksId []int64
 	for _, v := range taskEntities {
 		tasksId = append(tasksId, v.ID)
 	}
-	jsonB, err := json.Marshal(tasksId)
+	ctx := access.TaskContext(c)
+	response, err := p.tasks.Batch(ctx, tasksId)
 	if err != nil {
-		p.log.Warn("marshal err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
-		return
-	}
-	headers := map[string]string{"Authorization": c.GetHeader("Authorization")}
-	if err := p.sendRequest(http.MethodPost, "/tasks/batch", bytes.NewBuffer([]byte(jsonB)), &response, &headers); err != nil {
-		p.log.Warn("sendRequest err", err)
-		c.JSON(http.StatusBadGateway, err.Error())
+		p.log.Warn("task client err", err)
+		c.JSON(taskclient.Status(err), err.Error())
 		return
 	}
 	var resp []models.Task
@@ -365,40 +391,48 @@ func (p taskHandler) GetTaskByMilestone(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-func (p taskHandler) sendRequest(method, uri string, reader io.Reader, respStruct interface{}, headers *map[string]string) error {
-	req, err := http.NewRequest(method, p.conf.Task.Addr+uri, reader)
-	if err != nil {
-		return err
-	}
-	client := http.Client{
-		Timeout: 15 * time.Second,
-	}
+// ClientMetrics reports request, retry and circuit breaker counters of the
+// task service client.
+func (p taskHandler) ClientMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, p.tasks.Metrics())
+}
 
-	// req.Header.Set("Content-Type")
-	if headers != nil {
-		for s, v := range *headers {
-			req.Header.Set(s, v)
-		}
+// GetOutboxEntry reports the delivery state of a queued task change.
+func (p taskHandler) GetOutboxEntry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warn("wrong id param", err)
+		c.JSON(http.StatusBadRequest, "wrong id")
+		return
 	}
-	resp, err := client.Do(req)
+	entry, err := outbox.New(p.db.GetDB()).Get(id)
 	if err != nil {
-		return err
+		c.JSON(http.StatusNotFound, "outbox entry not found")
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if respStruct != nil {
-			err = json.Unmarshal(body, &respStruct)
 
-			if err != nil {
-				return err
-			}
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"outbox_id":  entry.ID,
+		"op":         entry.Op,
+		"task_id":    entry.TaskID,
+		"status":     entry.Status,
+		"attempts":   entry.Attempts,
+		"last_error": entry.LastError,
+	})
+}
 
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return errors.New(string(body))
-	}
+func (p taskHandler) dispatcher() dispatcher.Dispatcher {
+	return dispatcher.New(p.db.GetDB(), p.tasks, p.bus, p.log, p.conf.Scheduler.OutboxMaxAttempts)
+}
 
-	return nil
+// dispatchFailed answers 202 for changes left to the outbox worker, and the
+// mapped task service error for rejected ones.
+func (p taskHandler) dispatchFailed(c *gin.Context, entry outbox.EntryEntity, err error) {
+	if errors.Is(err, dispatcher.ErrPending) {
+		p.log.Warn("task change queued", entry.ID, err)
+		c.JSON(http.StatusAccepted, gin.H{"outbox_id": entry.ID, "status": outbox.Pending})
+		return
+	}
+	p.log.Warn("task client err", err)
+	c.JSON(taskclient.Status(err), err.Error())
 }
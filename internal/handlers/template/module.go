@@ -1,12 +1,17 @@
 package template
 
 import (
+	"errors"
 	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/membership"
 	"projects/internal/database/milestone"
 	"projects/internal/database/stage"
 	"projects/internal/models"
+	"projects/internal/progress"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +29,7 @@ type TemplateHandler interface {
 type Params struct {
 	fx.In
 	db.DbInter
+	events.Bus
 	*config.Tuner
 	*logrus.Logger
 }
@@ -32,10 +38,11 @@ type templateHandler struct {
 	db   db.DbInter
 	log  *logrus.Logger
 	conf *config.Tuner
+	bus  events.Bus
 }
 
 func NewtemplateHandler(params Params) TemplateHandler {
-	return &templateHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+	return &templateHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner}
 }
 func (p templateHandler) UpdateTemplate(c *gin.Context) {
 	tr := p.db.GetDB().Begin()
@@ -54,6 +61,10 @@ func (p templateHandler) UpdateTemplate(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
 		return
 	}
+	if !access.New(p.db.GetDB(), p.log).Project(c, id, membership.Editor) {
+		tr.Rollback()
+		return
+	}
 	schedulesDB := sch.GetByProjectID(id)
 	var schedulesForUpdate []stage.StageEntity
 	for _, v := range stageReq.Stage {
@@ -104,7 +115,29 @@ func (p templateHandler) UpdateTemplate(c *gin.Context) {
 			milestonesForUpdate = append(milestonesForUpdate, *deleted)
 		}
 	}
+	statusBefore := make(map[int64]milestone.Status, len(milestonesDB))
+	for _, v := range milestonesDB {
+		statusBefore[v.MilestoneID] = v.Status
+	}
+	var statusChanged []milestone.MilestoneEntity
 	for _, milestoneForUpdate := range milestonesForUpdate {
+		if milestoneForUpdate.MilestoneID > 0 && milestoneForUpdate.Status != "" {
+			changed, err := st.ChangeStatus(milestoneForUpdate.MilestoneID, milestoneForUpdate.Status, "", "")
+			if err != nil {
+				tr.Rollback()
+				if errors.Is(err, milestone.ErrChecklistIncomplete) {
+					c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+					return
+				}
+				p.log.Warnln("milestones status change error")
+				c.JSON(http.StatusBadGateway, gin.H{"error": "milestones update error"})
+				return
+			}
+			if changed.Status != statusBefore[changed.MilestoneID] {
+				statusChanged = append(statusChanged, changed)
+			}
+			milestoneForUpdate.Status = ""
+		}
 		_, err := st.Update(milestoneForUpdate)
 		if err != nil {
 			tr.Rollback()
@@ -114,6 +147,9 @@ func (p templateHandler) UpdateTemplate(c *gin.Context) {
 		}
 	}
 	tr.Commit()
+	for _, m := range statusChanged {
+		p.bus.PublishAs(events.MilestoneStatusChanged, m, access.Caller(c))
+	}
 	p.log.Println("milestones and schedule update copmliete")
 	var projTemplate models.ProjectTemplate
 
@@ -151,6 +187,7 @@ func (p templateHandler) GetTemplates(c *gin.Context) {
 	st := milestone.New(db)
 	schedulesDB := sch.GetByProjectID(id)
 	milestonesDB := st.GetByProjectID(id)
+	stagesProgress := progress.Stages(milestonesDB)
 
 	var projTemplate models.ProjectTemplate
 
@@ -160,6 +197,7 @@ func (p templateHandler) GetTemplates(c *gin.Context) {
 				StageID: v.StageID, Order: v.Order,
 				Title: v.Title, DateStart: v.DateStart,
 				Description: v.Description, DateEnd: v.DateStop,
+				Progress: stagesProgress[v.StageID],
 			}
 			for _, v2 := range milestonesDB {
 				if !v2.Hidden {
@@ -173,6 +211,8 @@ func (p templateHandler) GetTemplates(c *gin.Context) {
 							DateStart:   v2.DateStart,
 							Description: v2.Description,
 							DateEnd:     v2.DateStop,
+							Weight:      v2.Weight,
+							Progress:    progress.Milestone(v2),
 						})
 					}
 				}
@@ -0,0 +1,265 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"projects/internal/database/epics"
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/database/webhook"
+	"projects/internal/models"
+	"projects/internal/progress"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+var Module = fx.Provide(NewWebhookHandler)
+
+const (
+	signatureHeader  = "X-Webhook-Signature"
+	timestampHeader  = "X-Webhook-Timestamp"
+	signaturePrefix  = "sha256="
+	defaultTolerance = 5 * time.Minute
+)
+
+type WebhookHandler interface {
+	TaskEvents(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	events.Bus
+	*config.Tuner
+	*logrus.Logger
+	taskclient.Client
+}
+
+type webhookHandler struct {
+	db    db.DbInter
+	log   *logrus.Logger
+	conf  *config.Tuner
+	tasks taskclient.Client
+	bus   events.Bus
+}
+
+func NewWebhookHandler(params Params) WebhookHandler {
+	return &webhookHandler{db: params.DbInter, bus: params.Bus, log: params.Logger, conf: params.Tuner, tasks: params.Client}
+}
+
+// TaskEvents applies task created/updated/deleted notifications of the task
+// service to the local task mapping. The body is signed with
+// HMAC-SHA256(secret, timestamp + "." + body), events are deduplicated by ID.
+// Events older than the last one applied to the task, events after its delete
+// and events of tasks with unsent outbox changes are acknowledged as skipped.
+func (p webhookHandler) TaskEvents(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		p.log.Warnln("read body err: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "can't read body"})
+		return
+	}
+	timestamp := c.GetHeader(timestampHeader)
+	if err := p.verify(timestamp, c.GetHeader(signatureHeader), body); err != nil {
+		p.log.Warnln("webhook rejected: ", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var event models.TaskEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bad payload"})
+		return
+	}
+	if event.ID == "" || event.Task.ID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "event id and task id are required"})
+		return
+	}
+	switch event.Type {
+	case models.TaskCreated, models.TaskUpdated, models.TaskDeleted:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type"})
+		return
+	}
+
+	if event.OccurredAt == 0 {
+		// verify checked the timestamp already
+		ts, _ := strconv.ParseInt(timestamp, 10, 64)
+		event.OccurredAt = ts * 1000
+	}
+
+	duplicate, skipped := false, false
+	affected := make(map[int64]bool)
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		fresh, err := webhook.New(tx).Register(event.ID, event.Type)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			duplicate = true
+			return nil
+		}
+		// local changes not sent yet win, the task service reports them back once they are
+		pending, err := outbox.New(tx).HasPending(event.Task.ID)
+		if err != nil || pending {
+			skipped = pending
+			return err
+		}
+		// events arriving out of order must not undo newer ones or revive deleted tasks
+		current, err := webhook.New(tx).Advance(event.Task.ID, event.OccurredAt, event.Type == models.TaskDeleted)
+		if err != nil || !current {
+			skipped = !current
+			return err
+		}
+		return p.apply(tx, event, affected)
+	})
+	if err != nil {
+		p.log.Warnln("apply task event err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusOK, gin.H{"result": "duplicate"})
+		return
+	}
+	if skipped {
+		c.JSON(http.StatusOK, gin.H{"result": "skipped"})
+		return
+	}
+	p.tasks.Invalidate(event.Task.ID)
+	for id := range affected {
+		if id != 0 {
+			p.bus.Publish(events.MilestoneTasksChanged, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p webhookHandler) verify(timestamp, signature string, body []byte) error {
+	secret := p.conf.Task.WebhookSecret
+	if secret == "" {
+		return errors.New("webhook secret is not configured")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing timestamp")
+	}
+	tolerance := defaultTolerance
+	if p.conf.Task.WebhookTolerance > 0 {
+		tolerance = time.Duration(p.conf.Task.WebhookTolerance) * time.Second
+	}
+	// events older than the tolerance could outlive their stored event ID
+	if math.Abs(float64(time.Now().Unix()-ts)) > tolerance.Seconds() {
+		return errors.New("timestamp out of tolerance")
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil || len(got) == 0 {
+		return errors.New("missing signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// apply updates task_entities for the event and recounts the progress of the
+// milestones the task left or joined, which are added to affected.
+func (p webhookHandler) apply(tx *gorm.DB, event models.TaskEvent, affected map[int64]bool) error {
+	repo := tasks.New(tx)
+	local, err := repo.GetTaskByID(event.Task.ID)
+	exists := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if exists {
+		affected[local.MilestoneID] = true
+	}
+	if event.Type == models.TaskDeleted {
+		if !exists {
+			return nil
+		}
+		if err := repo.DeleteTask(local.ID); err != nil {
+			return err
+		}
+		return recount(tx, affected)
+	}
+
+	entity := tasks.TaskEntity{
+		ID:          event.Task.ID,
+		MilestoneID: event.Task.MilestoneId,
+		EpicID:      event.Task.EpicID,
+		Done:        progress.TaskDone(event.Task),
+		Started:     progress.TaskStarted(event.Task),
+	}
+	if entity.EpicID > 0 {
+		epic, err := epics.NewEpic(tx).GetEpicByID(entity.EpicID)
+		if err != nil {
+			p.log.Warnln("task event for unknown epic ", entity.EpicID)
+			entity.EpicID = 0
+		} else {
+			// the epic decides the milestone, a task can't sit in an epic of another milestone
+			entity.MilestoneID = epic.MilestoneID
+		}
+	}
+	if entity.MilestoneID == 0 && exists {
+		entity.MilestoneID = local.MilestoneID
+		if event.Task.EpicID == 0 {
+			entity.EpicID = local.EpicID
+		}
+	}
+	if entity.MilestoneID == 0 {
+		// not one of our tasks
+		return nil
+	}
+	mile := milestone.New(tx).GetMilestoneByID(entity.MilestoneID)
+	if mile.MilestoneID == 0 {
+		p.log.Warnln("task event for unknown milestone ", entity.MilestoneID)
+		return nil
+	}
+	entity.ActionPlanID = mile.ActionPlanID
+
+	if err := repo.Upsert(entity); err != nil {
+		return err
+	}
+	affected[entity.MilestoneID] = true
+	return recount(tx, affected)
+}
+
+func recount(tx *gorm.DB, milestoneIDs map[int64]bool) error {
+	repo := tasks.New(tx)
+	ml := milestone.New(tx)
+	for id := range milestoneIDs {
+		if id == 0 {
+			continue
+		}
+		done, total, err := repo.CountByMilestoneID(id)
+		if err != nil {
+			return err
+		}
+		if err := ml.SetTaskCounts(id, done, total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
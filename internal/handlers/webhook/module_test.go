@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "hook-secret"
+	body := []byte(`{"id":"e1","type":"task.updated","task":{"id":1}}`)
+	now := time.Now().Unix()
+	ts := func(offset time.Duration) string {
+		return strconv.FormatInt(now+int64(offset/time.Second), 10)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		ok        bool
+	}{
+		{name: "valid", secret: secret, timestamp: ts(0), signature: sign(secret, ts(0), body), body: body, ok: true},
+		{name: "without prefix", secret: secret, timestamp: ts(0), signature: sign(secret, ts(0), body)[len(signaturePrefix):], body: body, ok: true},
+		{name: "skew within tolerance", secret: secret, timestamp: ts(-4 * time.Minute), signature: sign(secret, ts(-4*time.Minute), body), body: body, ok: true},
+		{name: "wrong secret", secret: secret, timestamp: ts(0), signature: sign("other", ts(0), body), body: body},
+		{name: "changed body", secret: secret, timestamp: ts(0), signature: sign(secret, ts(0), body), body: []byte(`{"id":"e2"}`)},
+		{name: "signature of another timestamp", secret: secret, timestamp: ts(0), signature: sign(secret, ts(-time.Second), body), body: body},
+		{name: "too old", secret: secret, timestamp: ts(-6 * time.Minute), signature: sign(secret, ts(-6*time.Minute), body), body: body},
+		{name: "too far ahead", secret: secret, timestamp: ts(6 * time.Minute), signature: sign(secret, ts(6*time.Minute), body), body: body},
+		{name: "no timestamp", secret: secret, signature: sign(secret, "", body), body: body},
+		{name: "no signature", secret: secret, timestamp: ts(0), body: body},
+		{name: "not hex", secret: secret, timestamp: ts(0), signature: signaturePrefix + "zz", body: body},
+		{name: "no secret configured", timestamp: ts(0), signature: sign("", ts(0), body), body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Tuner{Config: models.Config{Task: models.ConfTask{WebhookSecret: tt.secret}}}
+			err := webhookHandler{conf: conf}.verify(tt.timestamp, tt.signature, tt.body)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	const secret = "hook-secret"
+	body := []byte(`{}`)
+	old := strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	conf := &config.Tuner{Config: models.Config{Task: models.ConfTask{WebhookSecret: secret, WebhookTolerance: 60}}}
+	if err := (webhookHandler{conf: conf}).verify(old, sign(secret, old, body), body); err == nil {
+		t.Fatal("accepted a timestamp outside the configured tolerance")
+	}
+}
@@ -0,0 +1,471 @@
+package workspace
+
+import (
+	"errors"
+	"net/http"
+	"projects/internal/access"
+	"projects/internal/database/actionPlan"
+	"projects/internal/database/epics"
+	"projects/internal/database/membership"
+	"projects/internal/database/milestone"
+	"projects/internal/database/projects"
+	"projects/internal/database/stage"
+	"projects/internal/database/tasks"
+	"projects/internal/database/workspace"
+	"projects/internal/models"
+	"projects/internal/progress"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+var Module = fx.Provide(NewWorkspaceHandler)
+
+type WorkspaceHandler interface {
+	GetWorkspaces(c *gin.Context)
+	GetWorkspace(c *gin.Context)
+	CreateWorkspace(c *gin.Context)
+	UpdateWorkspace(c *gin.Context)
+	DeleteWorkspace(c *gin.Context)
+	GetActionPlans(c *gin.Context)
+	GetStages(c *gin.Context)
+	GetMilestones(c *gin.Context)
+	GetEpics(c *gin.Context)
+	GetMembers(c *gin.Context)
+	SetMember(c *gin.Context)
+	RemoveMember(c *gin.Context)
+}
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+type workspaceHandler struct {
+	db   db.DbInter
+	log  *logrus.Logger
+	conf *config.Tuner
+}
+
+func NewWorkspaceHandler(params Params) WorkspaceHandler {
+	return &workspaceHandler{db: params.DbInter, log: params.Logger, conf: params.Tuner}
+}
+
+// GetWorkspaces lists the workspaces of the project given by project_id.
+func (p workspaceHandler) GetWorkspaces(c *gin.Context) {
+	projectID, err := strconv.ParseInt(c.Query("project_id"), 10, 64)
+	if err != nil || projectID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id is required"})
+		return
+	}
+	ws, err := workspace.New(p.db.GetDB()).GetByProjectID(projectID)
+	if err != nil {
+		p.log.Warnln("get workspaces err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.Workspace{}
+	for _, w := range ws {
+		resp = append(resp, workspaceResp(w))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p workspaceHandler) GetWorkspace(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaceResp(ws))
+}
+
+func (p workspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req models.WorkspaceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if req.Type == nil || req.Title == nil || *req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type and title are required"})
+		return
+	}
+	wsType, err := workspace.ParseType(*req.Type)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ProjectID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project_id is required"})
+		return
+	}
+	proj, err := projects.New(p.db.GetDB()).Get(req.ProjectID)
+	if err != nil {
+		p.log.Warnln("get project err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if proj.ProjectID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "project not found"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).AddWorkspace(c, proj) {
+		return
+	}
+
+	ws := workspace.WorkspaceEntity{ProjectID: req.ProjectID, Type: wsType, Title: *req.Title}
+	err = p.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := workspace.New(tx).Create(&ws); err != nil {
+			return err
+		}
+		// the creator and the project owner administer the new workspace
+		for _, admin := range []string{access.UserID(c), proj.OwnerID} {
+			if admin == "" {
+				continue
+			}
+			if err := membership.New(tx).Set(&membership.MemberEntity{WorkspaceID: ws.WorkspaceID, UserID: admin, Role: membership.Admin}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		p.log.Warnln("Create workspace err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaceResp(ws))
+}
+
+// UpdateWorkspace changes the title and type, a workspace stays in its project.
+func (p workspaceHandler) UpdateWorkspace(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	var req models.WorkspaceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).Workspace(c, id, membership.Admin) {
+		return
+	}
+
+	updateColumns := make(map[string]interface{})
+	if req.Type != nil {
+		wsType, err := workspace.ParseType(*req.Type)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updateColumns["type"] = wsType
+	}
+	if req.Title != nil {
+		if *req.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title can't be empty"})
+			return
+		}
+		updateColumns["title"] = *req.Title
+	}
+	ws, err := workspace.New(p.db.GetDB()).Update(id, updateColumns)
+	if err != nil {
+		p.fail(c, "update workspace err: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaceResp(ws))
+}
+
+// DeleteWorkspace removes a workspace without action plans, the last
+// workspace of a project can't be deleted.
+func (p workspaceHandler) DeleteWorkspace(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).Workspace(c, id, membership.Admin) {
+		return
+	}
+	if err := workspace.New(p.db.GetDB()).Delete(id); err != nil {
+		p.fail(c, "delete workspace err: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+func (p workspaceHandler) GetActionPlans(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	plans, err := actionPlan.New(p.db.GetDB()).GetByWorkspaceID(ws.WorkspaceID)
+	if err != nil {
+		p.log.Warnln("GetByWorkspaceID err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	miles, err := milestone.New(p.db.GetDB()).Find(milestone.Filter{WorkspaceID: ws.WorkspaceID})
+	if err != nil {
+		p.log.Warnln("find milestones err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	plansProgress := progress.ActionPlans(miles)
+	resp := []models.ActionPlanResp{}
+	for _, v := range plans {
+		resp = append(resp, models.ActionPlanResp{
+			ActionPlanID: v.ActionPlanID,
+			WorkspaceID:  v.WorkspaceID,
+			ProjectID:    v.ProjectID,
+			Title:        v.Title,
+			Status:       v.Status.String(),
+			Created:      v.Created,
+			PhaseID:      v.PhaseID,
+			Progress:     plansProgress[v.ActionPlanID],
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p workspaceHandler) GetStages(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	miles, err := milestone.New(p.db.GetDB()).Find(milestone.Filter{WorkspaceID: ws.WorkspaceID})
+	if err != nil {
+		p.log.Warnln("find milestones err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	stagesProgress := progress.Stages(miles)
+	resp := []models.Stage{}
+	for _, st := range stage.New(p.db.GetDB()).GetByWorkspaceID(ws.WorkspaceID) {
+		resp = append(resp, models.Stage{
+			StageID:      st.StageID,
+			Order:        st.Order,
+			Title:        st.Title,
+			DateStart:    st.DateStart,
+			Description:  st.Description,
+			DateEnd:      st.DateStop,
+			ProjectID:    st.ProjectID,
+			WorkspaceID:  st.WorkspaceID,
+			ActionPlanID: st.ActionPlanID,
+			Overdue:      st.Overdue,
+			Progress:     stagesProgress[st.StageID],
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p workspaceHandler) GetMilestones(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	miles, err := milestone.New(p.db.GetDB()).Find(milestone.Filter{
+		WorkspaceID: ws.WorkspaceID,
+		Status:      milestone.Status(c.Query("status")),
+	})
+	if err != nil {
+		p.log.Warnln("find milestones err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.Milestone{}
+	for _, m := range miles {
+		resp = append(resp, models.Milestone{
+			MilestoneID: m.MilestoneID,
+			ProjectID:   m.ProjectID,
+			StageID:     m.StageID,
+			Order:       m.Order,
+			Status:      m.Status.String(),
+			DateStart:   m.DateStart,
+			Description: m.Description,
+			DateEnd:     m.DateStop,
+			Title:       m.Title,
+			AssignID:    m.AssignID,
+			ProcessID:   m.ProcessID,
+			Weight:      m.Weight,
+			Progress:    progress.Milestone(m),
+			Overdue:     m.Overdue,
+
+			CompletionProposed: m.CompletionProposed,
+
+			ActualStart:  m.ActualStart,
+			ActualFinish: m.ActualFinish,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p workspaceHandler) GetEpics(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	eps, err := epics.NewEpic(p.db.GetDB()).GetEpic(epics.EpicEntity{WorkspaceID: ws.WorkspaceID})
+	if err != nil {
+		p.log.Warnln("get epics err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	statuses, err := progress.EpicStatuses(tasks.New(p.db.GetDB()), eps)
+	if err != nil {
+		p.log.Warnln("get epic tasks err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.EpicResponse{}
+	for _, e := range eps {
+		resp = append(resp, models.EpicResponse{
+			ID:          e.ID,
+			WorkspaceID: e.WorkspaceID,
+			ProjectID:   e.ProjectID,
+			StageID:     e.StageID,
+			MilestoneID: e.MilestoneID,
+			Title:       e.Title,
+			Description: e.Description,
+			Status:      e.Status,
+			Order:       e.Order,
+
+			ComputedStatus: string(statuses[e.ID]),
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (p workspaceHandler) GetMembers(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	members, err := membership.New(p.db.GetDB()).GetByWorkspaceID(ws.WorkspaceID)
+	if err != nil {
+		p.log.Warnln("get members err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	resp := []models.Member{}
+	for _, m := range members {
+		resp = append(resp, memberResp(m))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetMember adds a member or changes its role. The first member of a
+// workspace has to be an admin, from then on only members may change it.
+func (p workspaceHandler) SetMember(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	var req models.MemberReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		p.log.Warnln("bind error")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bind error"})
+		return
+	}
+	role, err := membership.ParseRole(req.Role)
+	if err != nil || req.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id and a valid role are required"})
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).Administer(c, ws) {
+		return
+	}
+
+	member := membership.MemberEntity{WorkspaceID: ws.WorkspaceID, UserID: req.UserID, Role: role}
+	if err := membership.New(p.db.GetDB()).Set(&member); err != nil {
+		p.fail(c, "set member err: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, memberResp(member))
+}
+
+func (p workspaceHandler) RemoveMember(c *gin.Context) {
+	ws, ok := p.workspace(c)
+	if !ok {
+		return
+	}
+	if !access.New(p.db.GetDB(), p.log).Administer(c, ws) {
+		return
+	}
+	if err := membership.New(p.db.GetDB()).Remove(ws.WorkspaceID, c.Param("user_id")); err != nil {
+		p.fail(c, "remove member err: ", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// workspace loads the workspace of the :id param, answering the request
+// itself when that fails.
+func (p workspaceHandler) workspace(c *gin.Context) (workspace.WorkspaceEntity, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		p.log.Warnln("Param err: ", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return workspace.WorkspaceEntity{}, false
+	}
+	ws, err := workspace.New(p.db.GetDB()).Get(id)
+	if err != nil {
+		p.fail(c, "get workspace err: ", err)
+		return ws, false
+	}
+	return ws, true
+}
+
+func (p workspaceHandler) fail(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, workspace.ErrNotEmpty), errors.Is(err, workspace.ErrLastWorkspace),
+		errors.Is(err, membership.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		p.log.Warnln(msg, err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+func workspaceResp(ws workspace.WorkspaceEntity) models.Workspace {
+	return models.Workspace{
+		WorkspaceID: ws.WorkspaceID,
+		ProjectID:   ws.ProjectID,
+		Type:        ws.Type.String(),
+		Title:       ws.Title,
+	}
+}
+
+func memberResp(m membership.MemberEntity) models.Member {
+	return models.Member{
+		WorkspaceID: m.WorkspaceID,
+		UserID:      m.UserID,
+		Role:        m.Role.String(),
+		Created:     m.Created,
+	}
+}
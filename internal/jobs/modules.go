@@ -0,0 +1,14 @@
+package jobs
+
+import (
+	"go.uber.org/fx"
+)
+
+var Module = fx.Options(
+	fx.Invoke(RegisterOverdue),
+	fx.Invoke(RegisterReconcile),
+	fx.Invoke(RegisterOutbox),
+	fx.Invoke(RegisterWebhookCleanup),
+	fx.Invoke(RegisterStatusFlow),
+	fx.Invoke(RegisterStandardWork),
+)
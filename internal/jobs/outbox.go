@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/database/outbox"
+	"projects/internal/dispatcher"
+	"projects/internal/taskbackend"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/scheduler"
+	"projects/pkg/taskclient"
+)
+
+const (
+	defaultOutboxInterval = 30 * time.Second
+	outboxBatch           = 100
+	outboxRetention       = 7 * 24 * time.Hour
+)
+
+type OutboxParams struct {
+	fx.In
+	db.DbInter
+	events.Bus
+	taskclient.Client
+	scheduler.Scheduler
+	*config.Tuner
+	*logrus.Logger
+}
+
+// RegisterOutbox sends queued task changes the request handlers could not
+// deliver and drops delivered entries after a week. Entries are always sent
+// with Task.ServiceToken, the worker does not start without it unless the
+// tasks are native.
+func RegisterOutbox(params OutboxParams) {
+	if params.Tuner.Task.ServiceToken == "" && params.Tuner.Task.Backend != taskbackend.Native {
+		params.Logger.Errorln("outbox worker disabled: Task.ServiceToken is not set, queued task changes are not retried")
+		return
+	}
+	interval := time.Duration(params.Tuner.Scheduler.OutboxInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultOutboxInterval
+	}
+	params.Scheduler.Every("outbox", interval, func(ctx context.Context) error {
+		d := dispatcher.New(params.DbInter.GetDB(), params.Client, params.Bus, params.Logger, params.Tuner.Scheduler.OutboxMaxAttempts)
+		sent, err := d.RunDue(taskclient.WithServiceAuth(ctx, params.Tuner), outboxBatch)
+		if err != nil {
+			return err
+		}
+		if sent > 0 {
+			params.Logger.Infoln("outbox entries sent: ", sent)
+		}
+		_, err = outbox.New(params.DbInter.GetDB()).DeleteDone(time.Now().Add(-outboxRetention).Unix())
+		return err
+	})
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/database/milestone"
+	"projects/internal/database/stage"
+	"projects/pkg/config"
+	"projects/pkg/dates"
+	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/scheduler"
+)
+
+const defaultOverdueInterval = 10 * time.Minute
+
+type OverdueParams struct {
+	fx.In
+	db.DbInter
+	events.Bus
+	scheduler.Scheduler
+	*config.Tuner
+	*logrus.Logger
+}
+
+type overdueJob struct {
+	db  db.DbInter
+	bus events.Bus
+	log *logrus.Logger
+}
+
+func RegisterOverdue(params OverdueParams) {
+	interval := time.Duration(params.Tuner.Scheduler.OverdueInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultOverdueInterval
+	}
+	job := overdueJob{db: params.DbInter, bus: params.Bus, log: params.Logger}
+	params.Scheduler.Every("overdue", interval, job.Run)
+}
+
+// Run flags milestones and stages past date_stop that still have open work and
+// publishes an event for everything that became overdue since the last run.
+func (j overdueJob) Run(_ context.Context) error {
+	ml := milestone.New(j.db.GetDB())
+	st := stage.New(j.db.GetDB())
+	today := dates.Day(time.Now())
+
+	openByStage := make(map[int64]bool)
+	var overdueMiles []int64
+	for _, m := range ml.GetOpen() {
+		openByStage[m.StageID] = true
+		if stop, ok := dates.Parse(m.DateStop); ok && stop.Before(today) {
+			overdueMiles = append(overdueMiles, m.MilestoneID)
+		}
+	}
+	var overdueStages []int64
+	for _, s := range st.GetWithDeadline() {
+		if !openByStage[s.StageID] {
+			continue
+		}
+		if stop, ok := dates.Parse(s.DateStop); ok && stop.Before(today) {
+			overdueStages = append(overdueStages, s.StageID)
+		}
+	}
+
+	freshMiles, err := ml.MarkOverdue(overdueMiles)
+	if err != nil {
+		return err
+	}
+	freshStages, err := st.MarkOverdue(overdueStages)
+	if err != nil {
+		return err
+	}
+	for _, m := range freshMiles {
+		j.bus.Publish(events.MilestoneOverdue, m)
+	}
+	for _, s := range freshStages {
+		j.bus.Publish(events.StageOverdue, s)
+	}
+	if len(freshMiles) > 0 || len(freshStages) > 0 {
+		j.log.Infof("overdue: %d new milestones, %d new stages", len(freshMiles), len(freshStages))
+	}
+
+	return nil
+}
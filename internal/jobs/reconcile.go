@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/reconcile"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/scheduler"
+	"projects/pkg/taskclient"
+)
+
+type ReconcileParams struct {
+	fx.In
+	db.DbInter
+	taskclient.Client
+	scheduler.Scheduler
+	*config.Tuner
+	*logrus.Logger
+}
+
+// RegisterReconcile compares task_entities with the task service periodically,
+// repairing the differences when Scheduler.ReconcileRepair is set.
+func RegisterReconcile(params ReconcileParams) {
+	conf := params.Tuner.Scheduler
+	if conf.ReconcileInterval <= 0 {
+		return
+	}
+	if params.Tuner.Task.ServiceToken == "" {
+		params.Logger.Warnln("reconcile job disabled: Task.ServiceToken is not set")
+		return
+	}
+	params.Scheduler.Every("reconcile", time.Duration(conf.ReconcileInterval)*time.Second, func(ctx context.Context) error {
+		rec := reconcile.New(params.DbInter.GetDB(), params.Client, params.Logger)
+		report, err := rec.Run(taskclient.WithServiceAuth(ctx, params.Tuner), conf.ReconcileRepair)
+		if err != nil {
+			return err
+		}
+		if !report.Clean() {
+			params.Logger.Warnf("reconcile: checked %d, dangling %v, orphans %v, mismatched %v, repaired %d, errors %v",
+				report.Checked, report.Dangling, report.Orphans, report.Mismatched, report.Repaired, report.Errors)
+		}
+		return nil
+	})
+}
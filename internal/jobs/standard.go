@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+
+	"projects/internal/database/epics"
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/processes"
+	"projects/internal/database/projects"
+	"projects/internal/dispatcher"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/events"
+	"projects/pkg/taskclient"
+)
+
+const (
+	standardConcurrency = 8
+	standardTimeout     = time.Minute
+)
+
+type StandardWorkParams struct {
+	fx.In
+	db.DbInter
+	events.Bus
+	taskclient.Client
+	*config.Tuner
+	*logrus.Logger
+}
+
+type standardWork struct {
+	db     db.DbInter
+	bus    events.Bus
+	client taskclient.Client
+	conf   *config.Tuner
+	log    *logrus.Logger
+}
+
+// RegisterStandardWork generates the standard epics and tasks of a process in
+// milestones newly linked to it. Epics are created right away, tasks go
+// through the outbox and are sent in the background.
+func RegisterStandardWork(params StandardWorkParams) {
+	work := standardWork{db: params.DbInter, bus: params.Bus, client: params.Client, conf: params.Tuner, log: params.Logger}
+	params.Bus.Subscribe(events.MilestoneProcessLinked, work.onLinked)
+}
+
+func (w standardWork) onLinked(e events.Event) {
+	mile, ok := e.Payload.(milestone.MilestoneEntity)
+	if !ok || mile.MilestoneID == 0 || mile.ProcessID == 0 {
+		return
+	}
+	stdEpics, stdTasks, err := processes.New(w.db.GetDB()).GetStandard(mile.ProcessID)
+	if err != nil {
+		w.log.Warnln("standard work: get standard err: ", mile.ProcessID, err)
+		return
+	}
+	if len(stdEpics) == 0 && len(stdTasks) == 0 {
+		return
+	}
+	base := w.taskBase(mile, e.Caller)
+
+	var entries []outbox.EntryEntity
+	err = w.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		epicRepo := epics.NewEpic(tx)
+		for _, se := range stdEpics {
+			epic, err := epicRepo.CreateEpic(epics.EpicEntity{
+				MilestoneID: mile.MilestoneID,
+				Title:       se.Title,
+				Description: se.Description,
+			})
+			if err != nil {
+				return err
+			}
+			for _, st := range se.Tasks {
+				entry, err := createEntry(base, epic.ID, st)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, entry)
+			}
+		}
+		for _, st := range stdTasks {
+			entry, err := createEntry(base, 0, st)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return outbox.New(tx).AddBatch(entries)
+	})
+	if err != nil {
+		w.log.Warnln("standard work: generate err: ", mile.MilestoneID, err)
+		return
+	}
+	w.log.Infof("standard work: milestone %d got %d epics, %d tasks queued", mile.MilestoneID, len(stdEpics), len(entries))
+
+	if len(entries) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), standardTimeout)
+		defer cancel()
+		d := dispatcher.New(w.db.GetDB(), w.client, w.bus, w.log, w.conf.Scheduler.OutboxMaxAttempts)
+		// the caller's token is only used right away, the outbox worker retries with the service token
+		ctx = taskclient.WithDefaultAuthorization(taskclient.WithAuthorization(ctx, e.Caller.Authorization), w.conf.Task.ServiceToken)
+		ctx = taskclient.WithCompany(ctx, e.Caller.Company)
+		d.DispatchBatch(ctx, entries, standardConcurrency)
+	}()
+}
+
+// taskBase holds the fields every generated task of the milestone shares. The
+// caller that linked the process creates the tasks, the project owner when
+// there is none.
+func (w standardWork) taskBase(mile milestone.MilestoneEntity, caller events.Caller) models.TaskReq {
+	base := models.TaskReq{
+		MilestoneID: mile.MilestoneID,
+		ProjectID:   strconv.FormatInt(mile.ProjectID, 10),
+		CompanyID:   caller.Company,
+		CreatorID:   caller.UserID,
+	}
+	if base.CreatorID == "" {
+		if project, err := projects.New(w.db.GetDB()).Get(mile.ProjectID); err == nil {
+			base.CreatorID = project.OwnerID
+		}
+	}
+	return base
+}
+
+func createEntry(base models.TaskReq, epicID int64, st processes.StandardTaskEntity) (outbox.EntryEntity, error) {
+	req := base
+	req.EpicID = epicID
+	req.Title = st.Title
+	req.Description = st.Description
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return outbox.EntryEntity{}, err
+	}
+	return outbox.EntryEntity{Op: outbox.OpCreate, Payload: string(payload), UserID: base.CreatorID, CompanyID: base.CompanyID}, nil
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/events"
+)
+
+// systemUser is recorded in the status history of automatic transitions.
+const systemUser = "system"
+
+type StatusFlowParams struct {
+	fx.In
+	db.DbInter
+	events.Bus
+	*config.Tuner
+	*logrus.Logger
+}
+
+type statusFlow struct {
+	db     db.DbInter
+	bus    events.Bus
+	log    *logrus.Logger
+	pushes map[milestone.Status]string
+}
+
+// RegisterStatusFlow keeps milestone and task statuses consistent. Task state
+// changes move a new milestone to in progress and propose completion when all
+// its tasks are resolved, milestone status changes are pushed to open tasks as
+// configured in [StatusMap].
+func RegisterStatusFlow(params StatusFlowParams) {
+	conf := params.Tuner.StatusMap
+	flow := statusFlow{
+		db:  params.DbInter,
+		bus: params.Bus,
+		log: params.Logger,
+		pushes: map[milestone.Status]string{
+			milestone.Hold:      strings.TrimSpace(conf.OnMilestoneHold),
+			milestone.Completed: strings.TrimSpace(conf.OnMilestoneCompleted),
+			milestone.Cancelled: strings.TrimSpace(conf.OnMilestoneCancelled),
+		},
+	}
+	params.Bus.Subscribe(events.MilestoneTasksChanged, flow.onTasksChanged)
+	params.Bus.Subscribe(events.MilestoneStatusChanged, flow.onStatusChanged)
+}
+
+func (f statusFlow) onTasksChanged(e events.Event) {
+	milestoneID, ok := e.Payload.(int64)
+	if !ok || milestoneID == 0 {
+		return
+	}
+	ml := milestone.New(f.db.GetDB())
+	mile := ml.GetMilestoneByID(milestoneID)
+	if mile.MilestoneID == 0 {
+		return
+	}
+	repo := tasks.New(f.db.GetDB())
+	done, total, err := repo.CountByMilestoneID(milestoneID)
+	if err != nil {
+		f.log.Warnln("status flow: count tasks err: ", err)
+		return
+	}
+	started, err := repo.CountStarted(milestoneID)
+	if err != nil {
+		f.log.Warnln("status flow: count started tasks err: ", err)
+		return
+	}
+
+	if mile.Status == milestone.NewStatus && started > 0 {
+		changed, err := ml.ChangeStatus(milestoneID, milestone.InProgress, systemUser, "first task started")
+		if err != nil {
+			f.log.Warnln("status flow: start milestone err: ", milestoneID, err)
+		} else {
+			mile = changed
+			f.bus.PublishAs(events.MilestoneStatusChanged, mile, e.Caller)
+		}
+	}
+
+	proposed := total > 0 && done == total &&
+		mile.Status != milestone.Completed && mile.Status != milestone.Cancelled
+	if proposed == mile.CompletionProposed {
+		return
+	}
+	if err := ml.UpdateColumns(milestoneID, map[string]interface{}{"completion_proposed": proposed}); err != nil {
+		f.log.Warnln("status flow: propose completion err: ", milestoneID, err)
+		return
+	}
+	if proposed {
+		mile.CompletionProposed = true
+		f.bus.Publish(events.MilestoneCompletionProposed, mile)
+	}
+}
+
+// onStatusChanged queues the mapped task status for the open tasks of the
+// milestone, the outbox worker sends them. The local done and started flags
+// follow once the task service accepted the update.
+func (f statusFlow) onStatusChanged(e events.Event) {
+	mile, ok := e.Payload.(milestone.MilestoneEntity)
+	if !ok {
+		return
+	}
+	status := f.pushes[mile.Status]
+	if status == "" {
+		return
+	}
+
+	open, err := tasks.New(f.db.GetDB()).GetOpenByMilestoneID(mile.MilestoneID)
+	if err == nil {
+		err = f.queue(open, status, e.Caller)
+	}
+	if err != nil {
+		f.log.Warnln("status flow: push task status err: ", mile.MilestoneID, err)
+		return
+	}
+	if len(open) > 0 {
+		f.log.Infof("status flow: milestone %d is %s, %d tasks queued as %q", mile.MilestoneID, mile.Status, len(open), status)
+	}
+}
+
+func (f statusFlow) queue(open []tasks.TaskEntity, status string, caller events.Caller) error {
+	if len(open) == 0 {
+		return nil
+	}
+	entries := make([]outbox.EntryEntity, 0, len(open))
+	for _, t := range open {
+		payload, err := json.Marshal(models.TaskReq{MilestoneID: t.MilestoneID, EpicID: t.EpicID, Status: status})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, outbox.EntryEntity{Op: outbox.OpUpdate, TaskID: t.ID, Payload: string(payload), UserID: caller.UserID, CompanyID: caller.Company})
+	}
+	return outbox.New(f.db.GetDB()).AddBatch(entries)
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/internal/database/webhook"
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/scheduler"
+)
+
+const (
+	defaultWebhookRetention = 7 * 24 * time.Hour
+	webhookCleanupInterval  = time.Hour
+)
+
+type WebhookCleanupParams struct {
+	fx.In
+	db.DbInter
+	scheduler.Scheduler
+	*config.Tuner
+	*logrus.Logger
+}
+
+// RegisterWebhookCleanup drops remembered webhook event IDs past the retention
+// period. Older deliveries are already rejected by their timestamp.
+func RegisterWebhookCleanup(params WebhookCleanupParams) {
+	retention := time.Duration(params.Tuner.Scheduler.WebhookRetention) * time.Second
+	if retention <= 0 {
+		retention = defaultWebhookRetention
+	}
+	params.Scheduler.Every("webhook-cleanup", webhookCleanupInterval, func(_ context.Context) error {
+		deleted, err := webhook.New(params.DbInter.GetDB()).DeleteBefore(time.Now().Add(-retention).Unix())
+		if err != nil {
+			return err
+		}
+		if deleted > 0 {
+			params.Logger.Infoln("webhook events cleaned up: ", deleted)
+		}
+		return nil
+	})
+}
@@ -1,13 +1,21 @@
 package models
 
 type EpicRequest struct {
-	ID          int64  `json:"id,omitempty"`
-	WorkspaceID int64  `json:"workspace_id,omitempty"`
-	ProjectID   int64  `json:"project_id,omitempty"`
-	StageID     int64  `json:"stage_id,omitempty"`
-	MilestoneID int64  `json:"milestone_id,omitempty"`
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
+	ID          int64   `json:"id,omitempty"`
+	WorkspaceID int64   `json:"workspace_id,omitempty"`
+	ProjectID   int64   `json:"project_id,omitempty"`
+	StageID     int64   `json:"stage_id,omitempty"`
+	MilestoneID int64   `json:"milestone_id,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	Order       int     `json:"order,omitempty"`
+	TagIDs      []int64 `json:"tag_ids,omitempty"`
+}
+
+type EpicMove struct {
+	MilestoneID int64 `json:"milestone_id"`
+	Order       *int  `json:"order"`
 }
 
 type EpicResponse struct {
@@ -18,5 +26,10 @@ type EpicResponse struct {
 	MilestoneID int64  `json:"milestone_id,omitempty"`
 	Title       string `json:"title,omitempty"`
 	Description string `json:"description,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Order       int    `json:"order"`
 	Task        []Task `json:"task"`
+
+	ComputedStatus string  `json:"computed_status,omitempty"`
+	Progress       float64 `json:"progress"`
 }
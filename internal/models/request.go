@@ -16,17 +16,96 @@ type ProjectReq struct {
 	Priority        *int    `json:"priority"`
 	PipelineManager *string `json:"pipeline_manager"`
 	ProjectManager  *string `json:"project_manager"`
+
+	// Workspaces are created with a new project, the first one gets the main
+	// action plan. Without them a single "main" legal workspace is created.
+	Workspaces []WorkspaceReq `json:"workspaces"`
 }
 
 type MilestoneFilter struct {
-	MilestoneID int   `json:"milestone_id"`
-	ProjectID   int64 `json:"project_id"`
+	MilestoneID  int    `json:"milestone_id"`
+	ProjectID    int64  `json:"project_id"`
+	StageID      int64  `json:"stage_id"`
+	ActionPlanID int64  `json:"action_plan_id"`
+	Status       string `json:"status"`
+}
+
+type MilestonePatch struct {
+	MilestoneID   int64   `json:"milestone_id"`
+	Title         *string `json:"title"`
+	Description   *string `json:"description"`
+	Status        *string `json:"status"`
+	StatusComment string  `json:"status_comment"`
+	AssignID      *string `json:"assign_id"`
+	DateStart     *string `json:"date_start"`
+	DateEnd       *string `json:"date_end"`
+	Order         *int    `json:"order"`
+	Weight        *int    `json:"weight"`
+}
+
+// MilestoneBulk applies either the listed patches or one patch to every milestone
+// matched by the filter. Mode is "atomic" (default) or "best_effort".
+type MilestoneBulk struct {
+	Mode   string           `json:"mode"`
+	Items  []MilestonePatch `json:"items"`
+	Filter *MilestoneFilter `json:"filter"`
+	Update *MilestonePatch  `json:"update"`
+}
+
+type MilestoneMove struct {
+	StageID int64 `json:"stage_id"`
+	Order   *int  `json:"order"`
+}
+
+type AssigneeReq struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+type ChecklistItemReq struct {
+	Title    *string `json:"title"`
+	Order    *int    `json:"order"`
+	Required *bool   `json:"required"`
+	Done     *bool   `json:"done"`
+}
+
+// TaskFilter - query of GET /tasks. At least one of the project tree ids is
+// required, DueFrom/DueTo bound end_time and are inclusive.
+type TaskFilter struct {
+	ProjectID    int64  `form:"project_id"`
+	ActionPlanID int64  `form:"action_plan_id"`
+	StageID      int64  `form:"stage_id"`
+	MilestoneID  int64  `form:"milestone_id"`
+	EpicID       int64  `form:"epic_id"`
+	AssigneeID   string `form:"assignee_id"`
+	Status       string `form:"status"`
+	Priority     string `form:"priority"`
+	DueFrom      string `form:"due_from"`
+	DueTo        string `form:"due_to"`
+	Sort         string `form:"sort"`
+	Order        string `form:"order"`
+	Page         int    `form:"page"`
+	PerPage      int    `form:"per_page"`
 }
 
 type ProjectFilter struct {
 	Cluster *string `json:"cluster"`
 	Type    *string `json:"type"`
 	Stage   *string `json:"stage"`
+	TagIDs  []int64 `json:"tag_id" form:"tag_id"`
+}
+
+// WorkspaceReq - nil fields are left unchanged on update
+type WorkspaceReq struct {
+	ProjectID int64   `json:"project_id"`
+	Type      *string `json:"type"`
+	Title     *string `json:"title"`
+}
+
+// MemberReq - role is viewer, editor or admin
+type MemberReq struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
 }
 
 type ActionPlan struct {
@@ -37,7 +116,27 @@ type ActionPlan struct {
 	PhaseID     int64  `json:"phase_id"`
 }
 
+type TagReq struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type TagLinkReq struct {
+	EntityType string `json:"entity_type" form:"entity_type"`
+	EntityID   int64  `json:"entity_id" form:"entity_id"`
+}
+
+// ProcessReq - nil fields are left unchanged on update, a new process is active
+// unless active is false
 type ProcessReq struct {
-	ProcessID int64  `json:"process_id"`
-	Name      string `json:"name"`
+	ProcessID   int64   `json:"process_id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	OwnerTeam   *string `json:"owner_team"`
+	Active      *bool   `json:"active"`
+}
+
+type ProcessLinkReq struct {
+	MilestoneIDs []int64 `json:"milestone_ids"`
 }
@@ -17,11 +17,27 @@ type ProjectResp struct {
 	Created         int64            `json:"created"`
 	Category        string           `json:"category"`
 	Template        *ProjectTemplate `json:"template"`
+	Progress        float64          `json:"progress"`
 	Region          string           `json:"region"`
 	Status          string           `json:"status"`
 	Priority        int              `json:"priority"`
 	PipelineManager string           `json:"pipeline_manager"`
 	ProjectManager  string           `json:"project_manager"`
+	Workspaces      []Workspace      `json:"workspaces,omitempty"`
+}
+
+type Workspace struct {
+	WorkspaceID int64  `json:"workspace_id"`
+	ProjectID   int64  `json:"project_id"`
+	Type        string `json:"type"`
+	Title       string `json:"title"`
+}
+
+type Member struct {
+	WorkspaceID int64  `json:"workspace_id"`
+	UserID      string `json:"user_id"`
+	Role        string `json:"role"`
+	Created     int64  `json:"created"`
 }
 
 type ProjectTemplate struct {
@@ -44,7 +60,9 @@ type Stage struct {
 	WorkspaceID  int64  `json:"workspace_id"`
 	ActionPlanID int64  `json:"action_plan_id"`
 	Hidden       bool   `json:"hidden"`
+	Overdue      bool   `json:"overdue"`
 
+	Progress  float64     `json:"progress"`
 	Milestone []Milestone `json:"milestone"`
 }
 
@@ -66,19 +84,142 @@ type Milestone struct {
 	Epic        []EpicResponse `json:"epic,omitempty"`
 	Task        []Task         `json:"task,omitempty"`
 	ProcessID   int64          `json:"process_id"`
+	Assignees   []Assignee     `json:"assignees,omitempty"`
+	Weight      int            `json:"weight,omitempty"`
+	Progress    float64        `json:"progress"`
+	Overdue     bool           `json:"overdue"`
+
+	RequireChecklist   *bool `json:"require_checklist,omitempty"`
+	CompletionProposed bool  `json:"completion_proposed,omitempty"`
+
+	ActualStart   int64  `json:"actual_start,omitempty"`
+	ActualFinish  int64  `json:"actual_finish,omitempty"`
+	ChangedBy     string `json:"changed_by,omitempty"`
+	StatusComment string `json:"status_comment,omitempty"`
+}
+
+type Assignee struct {
+	UserID  string `json:"user_id"`
+	Role    string `json:"role"`
+	Created int64  `json:"created"`
+}
+
+type ChecklistItem struct {
+	ID          int64  `json:"id"`
+	MilestoneID int64  `json:"milestone_id"`
+	Title       string `json:"title"`
+	Order       int    `json:"order"`
+	Required    bool   `json:"required"`
+	Done        bool   `json:"done"`
+	DoneBy      string `json:"done_by,omitempty"`
+	DoneAt      int64  `json:"done_at,omitempty"`
+}
+
+type BulkItemResult struct {
+	MilestoneID int64  `json:"milestone_id"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+type BulkResult struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+type MilestoneStatusChange struct {
+	ID          int64  `json:"id"`
+	MilestoneID int64  `json:"milestone_id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	UserID      string `json:"user_id"`
+	Comment     string `json:"comment"`
+	Created     int64  `json:"created"`
+}
+
+type Overdue struct {
+	Milestones []Milestone `json:"milestones"`
+	Stages     []Stage     `json:"stages"`
 }
 
 type ActionPlanResp struct {
 	ActionPlanID int64   `json:"action_plan_id"`
+	WorkspaceID  int64   `json:"workspace_id,omitempty"`
 	Stage        []Stage `json:"stage,omitempty"`
 	ProjectID    int64   `json:"project_id"`
 	Title        string  `json:"title"`
 	Created      int64   `json:"created"`
 	Status       string  `json:"status"`
 	PhaseID      int64   `json:"phase_id"`
+	Progress     float64 `json:"progress"`
+}
+
+type Tag struct {
+	TagID     int64            `json:"tag_id"`
+	CompanyID string           `json:"company_id"`
+	Name      string           `json:"name"`
+	Color     string           `json:"color"`
+	Usage     map[string]int64 `json:"usage,omitempty"`
+	Total     int64            `json:"total"`
 }
 
 type ProcessResp struct {
-	ProcessID int64  `json:"process_id"`
-	Name      string `json:"name"`
+	ProcessID   int64            `json:"process_id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Category    string           `json:"category"`
+	OwnerTeam   string           `json:"owner_team"`
+	Active      bool             `json:"active"`
+	Standard    *ProcessStandard `json:"standard,omitempty"`
+}
+
+// ProcessStandard - the epics and tasks generated in milestones linked to a
+// process, Tasks are the ones outside of any epic
+type ProcessStandard struct {
+	Epics []StandardEpic `json:"epics"`
+	Tasks []StandardTask `json:"tasks"`
+}
+
+type StandardEpic struct {
+	ID          int64          `json:"id,omitempty"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Order       int            `json:"order"`
+	Tasks       []StandardTask `json:"tasks"`
+}
+
+type StandardTask struct {
+	ID          int64  `json:"id,omitempty"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Order       int    `json:"order"`
+}
+
+type TaskList struct {
+	Items   []Task `json:"items"`
+	Total   int    `json:"total"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+}
+
+// ProcessReport - milestones of a process across the portfolio. Cycle times
+// are in days from the first move to in progress until completion.
+type ProcessReport struct {
+	ProcessID       int64          `json:"process_id"`
+	Name            string         `json:"name"`
+	Category        string         `json:"category"`
+	OwnerTeam       string         `json:"owner_team"`
+	Milestones      int            `json:"milestones"`
+	ByStatus        map[string]int `json:"by_status"`
+	Overdue         int            `json:"overdue"`
+	Measured        int            `json:"measured"`
+	AvgCycleDays    float64        `json:"avg_cycle_days"`
+	SlowestProjects []ProjectCycle `json:"slowest_projects"`
+}
+
+type ProjectCycle struct {
+	ProjectID    int64   `json:"project_id"`
+	Title        string  `json:"title"`
+	Measured     int     `json:"measured"`
+	AvgCycleDays float64 `json:"avg_cycle_days"`
 }
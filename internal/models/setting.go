@@ -4,6 +4,10 @@ type Config struct {
 	Main ConfMain
 	DB   ConfDB
 	Task ConfTask
+
+	Scheduler ConfScheduler
+	StatusMap ConfStatusMap
+	Auth      ConfAuth
 }
 
 // ConfMain - basic configuration
@@ -12,11 +16,83 @@ type ConfMain struct {
 	Name string
 }
 
+// ConfTask - task backend, "remote" (the task service at Addr, default) or
+// "native" (tasks stored in our database). For the remote client Timeout,
+// BreakerCooldown and the cache durations are in seconds, Backoff is in
+// milliseconds. CacheTTL = 0 disables the task cache, CacheStale is how long
+// expired entries may still be served.
+// WebhookSecret signs task service webhooks, WebhookTolerance is the accepted
+// clock skew of their timestamps in seconds. ServiceToken is sent as the
+// Authorization header of background jobs, the outbox worker and reconcile
+// need it with the remote backend.
 type ConfTask struct {
-	Addr string
-	Port string
-	Name string
+	Backend string
+	Addr    string
+	Port    string
+	Name    string
+
+	Timeout          int
+	Retries          int
+	Backoff          int
+	BreakerThreshold int
+	BreakerCooldown  int
+	CacheTTL         int
+	CacheStale       int
+	WebhookSecret    string
+	WebhookTolerance int
+	ServiceToken     string
+}
+
+// ConfScheduler - background jobs, intervals and retention periods are in
+// seconds, ReconcileInterval = 0 disables the scheduled reconciliation
+type ConfScheduler struct {
+	OverdueInterval   int
+	WebhookRetention  int
+	ReconcileInterval int
+	ReconcileRepair   bool
+	OutboxInterval    int
+	OutboxMaxAttempts int
+}
+
+// ConfStatusMap - maps task service statuses to milestone statuses and back.
+// TaskDone and TaskInitial are comma separated, case insensitive task statuses
+// (resolved and not started yet), the *IDs variants match status ids, empty
+// values keep the built-in sets. OnMilestone* is the task status pushed to the
+// open tasks of a milestone that enters that status, empty pushes nothing.
+type ConfStatusMap struct {
+	TaskDone       string
+	TaskInitial    string
+	TaskDoneIDs    string
+	TaskInitialIDs string
+
+	OnMilestoneHold      string
+	OnMilestoneCompleted string
+	OnMilestoneCancelled string
 }
+
+// ConfAuth - bearer token validation of the API. Secret verifies HS256 tokens,
+// JWKS is a file path or an http(s) URL of the signing keys (RSA for RS256,
+// oct for HS256), reloaded every JWKSRefresh seconds. Issuer and Audience are
+// checked when set, Leeway is the accepted clock skew in seconds. The *Claim
+// fields name the token claims of the caller, nested ones with dots. Public is
+// a comma separated list of paths served without a token, a trailing * matches
+// a prefix.
+type ConfAuth struct {
+	Enabled     bool
+	Secret      string
+	JWKS        string
+	JWKSRefresh int
+	Issuer      string
+	Audience    string
+	Leeway      int
+
+	UserClaim    string
+	CompanyClaim string
+	RolesClaim   string
+
+	Public string
+}
+
 type ConfDB struct {
 	Host     string
 	Port     string
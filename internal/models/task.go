@@ -19,6 +19,7 @@ type Task struct {
 	Status             string `json:"status,omitempty"`
 	StatusID           int64  `json:"status_id,omitempty"`
 	Title              string `json:"title,omitempty"`
+	Description        string `json:"description,omitempty"`
 }
 
 type TaskReq struct {
@@ -35,4 +36,52 @@ type TaskReq struct {
 	Priority    string `json:"priority"`
 	StartTime   string `json:"start_time"`
 	EndTime     string `json:"end_time"`
+	Status      string `json:"status,omitempty"`
+}
+
+// task service webhook event types
+const (
+	TaskCreated = "task.created"
+	TaskUpdated = "task.updated"
+	TaskDeleted = "task.deleted"
+)
+
+// TaskEvent is a change notification pushed by the task service. OccurredAt
+// is the time of the change in unix milliseconds, events without it are
+// ordered by their delivery timestamp.
+type TaskEvent struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	OccurredAt int64  `json:"occurred_at"`
+	Task       Task   `json:"task"`
+}
+
+// TaskBulk - POST /tasks/bulk, every item is placed under the milestone or
+// epic of the request. Items with an id update that task, the others are created.
+type TaskBulk struct {
+	MilestoneID int64          `json:"milestone_id"`
+	EpicID      int64          `json:"epic_id"`
+	Items       []TaskBulkItem `json:"items"`
+}
+
+type TaskBulkItem struct {
+	ID int64 `json:"id"`
+	TaskReq
+}
+
+// TaskBulkItemResult - Status is created, updated, pending (left to the outbox
+// worker) or failed.
+type TaskBulkItemResult struct {
+	Index    int    `json:"index"`
+	TaskID   int64  `json:"task_id,omitempty"`
+	OutboxID int64  `json:"outbox_id,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Task     *Task  `json:"task,omitempty"`
+}
+
+type TaskBulkResult struct {
+	MilestoneID int64                `json:"milestone_id"`
+	EpicID      int64                `json:"epic_id"`
+	Results     []TaskBulkItemResult `json:"results"`
 }
@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/pkg/config"
+)
+
+// Module loads the task status sets of [StatusMap], every binary that judges
+// task states needs it.
+var Module = fx.Invoke(Load)
+
+type Params struct {
+	fx.In
+	*config.Tuner
+	*logrus.Logger
+}
+
+func Load(params Params) {
+	conf := params.Tuner.StatusMap
+	Configure(splitList(conf.TaskDone), splitList(conf.TaskInitial),
+		splitIDs(conf.TaskDoneIDs, params.Logger), splitIDs(conf.TaskInitialIDs, params.Logger))
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func splitIDs(value string, log *logrus.Logger) []int64 {
+	var ids []int64
+	for _, v := range splitList(value) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Warnln("status map: bad status id ", v)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
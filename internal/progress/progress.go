@@ -0,0 +1,310 @@
+package progress
+
+import (
+	"math"
+	"strings"
+
+	"projects/internal/database/epics"
+	"projects/internal/database/milestone"
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+)
+
+// doneStatuses are task service statuses treated as resolved even without ResolvedTime.
+var doneStatuses = map[string]bool{
+	"done":      true,
+	"resolved":  true,
+	"closed":    true,
+	"completed": true,
+}
+
+// initialStatuses are task service statuses of tasks nobody started yet.
+var initialStatuses = map[string]bool{
+	"":        true,
+	"new":     true,
+	"open":    true,
+	"todo":    true,
+	"to do":   true,
+	"backlog": true,
+}
+
+// doneStatusIDs and initialStatusIDs match task service status ids, they are
+// empty unless configured.
+var (
+	doneStatusIDs    = map[int64]bool{}
+	initialStatusIDs = map[int64]bool{}
+)
+
+// Configure replaces the built-in status sets, empty arguments keep the
+// current set. It is meant to be called once at startup.
+func Configure(done, initial []string, doneIDs, initialIDs []int64) {
+	if len(done) > 0 {
+		doneStatuses = stringSet(done)
+	}
+	if len(initial) > 0 {
+		initialStatuses = stringSet(initial)
+		initialStatuses[""] = true
+	}
+	if len(doneIDs) > 0 {
+		doneStatusIDs = idSet(doneIDs)
+	}
+	if len(initialIDs) > 0 {
+		initialStatusIDs = idSet(initialIDs)
+	}
+}
+
+// TaskDone reports whether the task service considers the task resolved.
+func TaskDone(t models.Task) bool {
+	return t.ResolvedTime != "" || doneStatuses[strings.ToLower(t.Status)] || doneStatusIDs[t.StatusID]
+}
+
+// TaskStarted reports whether somebody started working on the task, resolved
+// tasks count as started.
+func TaskStarted(t models.Task) bool {
+	if TaskDone(t) {
+		return true
+	}
+	if t.StatusID != 0 && len(initialStatusIDs) > 0 {
+		return !initialStatusIDs[t.StatusID]
+	}
+	return !initialStatuses[strings.ToLower(t.Status)]
+}
+
+// Tasks counts resolved tasks.
+func Tasks(tasks []models.Task) (done, total int) {
+	for _, t := range tasks {
+		if TaskDone(t) {
+			done++
+		}
+	}
+	return done, len(tasks)
+}
+
+// EpicStatus derives the epic status from its tasks. Hold and cancelled are set
+// manually and win over the tasks, an epic without tasks keeps its own status.
+func EpicStatus(manual milestone.Status, tasks []models.Task) milestone.Status {
+	var done, started int
+	for _, t := range tasks {
+		if TaskDone(t) {
+			done++
+		}
+		if TaskStarted(t) {
+			started++
+		}
+	}
+	return epicStatus(manual, done, started, len(tasks))
+}
+
+// EpicStatuses derives the status of every epic from the done/started flags
+// stored in task_entities, so listings don't have to ask the task service.
+func EpicStatuses(repo tasks.Task, eps []epics.EpicEntity) (map[int64]milestone.Status, error) {
+	ids := make([]int64, 0, len(eps))
+	for _, e := range eps {
+		ids = append(ids, e.ID)
+	}
+	local, err := repo.GetByEpicIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	type counts struct{ done, started, total int }
+	byEpic := make(map[int64]counts)
+	for _, t := range local {
+		n := byEpic[t.EpicID]
+		n.total++
+		if t.Done {
+			n.done++
+		}
+		if t.Done || t.Started {
+			n.started++
+		}
+		byEpic[t.EpicID] = n
+	}
+	statuses := make(map[int64]milestone.Status, len(eps))
+	for _, e := range eps {
+		n := byEpic[e.ID]
+		statuses[e.ID] = epicStatus(milestone.Status(e.Status), n.done, n.started, n.total)
+	}
+	return statuses, nil
+}
+
+func epicStatus(manual milestone.Status, done, started, total int) milestone.Status {
+	switch {
+	case manual == milestone.Hold || manual == milestone.Cancelled || total == 0:
+		return manual
+	case done == total:
+		return milestone.Completed
+	case started > 0:
+		return milestone.InProgress
+	}
+	return milestone.NewStatus
+}
+
+// Percent returns done/total as a percentage rounded to one decimal.
+func Percent(done, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(done) * 100 / float64(total))
+}
+
+// Milestone returns the completion of a milestone. The cached task counts are
+// used when the milestone has tasks, otherwise the milestone status decides.
+func Milestone(m milestone.MilestoneEntity) float64 {
+	pct, _ := milestonePercent(m)
+	return pct
+}
+
+// milestonePercent also reports whether the milestone takes part in rollups,
+// cancelled milestones don't.
+func milestonePercent(m milestone.MilestoneEntity) (pct float64, counted bool) {
+	if m.Status == milestone.Cancelled {
+		return 0, false
+	}
+	if m.TasksTotal > 0 {
+		return Percent(m.TasksDone, m.TasksTotal), true
+	}
+	if m.Status == milestone.Completed {
+		return 100, true
+	}
+	return 0, true
+}
+
+// Stages rolls milestones up to their stages. Stages without counted milestones
+// are left out.
+func Stages(miles []milestone.MilestoneEntity) map[int64]float64 {
+	byStage := make(map[int64][]milestone.MilestoneEntity)
+	for _, m := range miles {
+		byStage[m.StageID] = append(byStage[m.StageID], m)
+	}
+	stages := make(map[int64]float64, len(byStage))
+	for id, ms := range byStage {
+		if pct, ok := weighted(ms); ok {
+			stages[id] = pct
+		}
+	}
+	return stages
+}
+
+func weighted(miles []milestone.MilestoneEntity) (float64, bool) {
+	var sum, weights float64
+	for _, m := range miles {
+		pct, counted := milestonePercent(m)
+		if !counted {
+			continue
+		}
+		w := float64(m.Weight)
+		if w <= 0 {
+			w = 1
+		}
+		sum += pct * w
+		weights += w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return round(sum / weights), true
+}
+
+// ActionPlans rolls milestones up to stages and stages up to action plans.
+func ActionPlans(miles []milestone.MilestoneEntity) map[int64]float64 {
+	byPlan := make(map[int64][]milestone.MilestoneEntity)
+	for _, m := range miles {
+		byPlan[m.ActionPlanID] = append(byPlan[m.ActionPlanID], m)
+	}
+	plans := make(map[int64]float64, len(byPlan))
+	for id, ms := range byPlan {
+		plans[id] = average(Stages(ms))
+	}
+	return plans
+}
+
+// Projects rolls milestones up through stages and action plans to projects.
+func Projects(miles []milestone.MilestoneEntity) map[int64]float64 {
+	byProject := make(map[int64][]milestone.MilestoneEntity)
+	for _, m := range miles {
+		byProject[m.ProjectID] = append(byProject[m.ProjectID], m)
+	}
+	projects := make(map[int64]float64, len(byProject))
+	for id, ms := range byProject {
+		projects[id] = average(ActionPlans(ms))
+	}
+	return projects
+}
+
+func average(values map[int64]float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return round(sum / float64(len(values)))
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	return set
+}
+
+func idSet(values []int64) map[int64]bool {
+	set := make(map[int64]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// SyncFlags stores the done/started flags of fetched tasks in task_entities
+// and returns the milestones whose tasks changed.
+func SyncFlags(repo tasks.Task, local []tasks.TaskEntity, remote []models.Task) ([]int64, error) {
+	done, started, milestones := FlagChanges(local, remote)
+	for d, ids := range done {
+		if err := repo.SetDone(ids, d); err != nil {
+			return nil, err
+		}
+	}
+	for s, ids := range started {
+		if err := repo.SetStarted(ids, s); err != nil {
+			return nil, err
+		}
+	}
+	return milestones, nil
+}
+
+// FlagChanges compares the done/started flags of local tasks with the fetched
+// ones. It returns the ids to set per flag value and the milestones affected.
+func FlagChanges(local []tasks.TaskEntity, remote []models.Task) (done, started map[bool][]int64, milestones []int64) {
+	remoteByID := make(map[int64]models.Task, len(remote))
+	for _, v := range remote {
+		remoteByID[v.ID] = v
+	}
+	done = make(map[bool][]int64)
+	started = make(map[bool][]int64)
+	seen := make(map[int64]bool)
+	for _, t := range local {
+		v, ok := remoteByID[t.ID]
+		if !ok {
+			continue
+		}
+		isDone, isStarted := TaskDone(v), TaskStarted(v)
+		if isDone != t.Done {
+			done[isDone] = append(done[isDone], t.ID)
+		}
+		if isStarted != t.Started {
+			started[isStarted] = append(started[isStarted], t.ID)
+		}
+		if (isDone != t.Done || isStarted != t.Started) && !seen[t.MilestoneID] {
+			seen[t.MilestoneID] = true
+			milestones = append(milestones, t.MilestoneID)
+		}
+	}
+	return done, started, milestones
+}
@@ -0,0 +1,261 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"projects/internal/database/epics"
+	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+	"projects/internal/progress"
+	"projects/pkg/taskclient"
+)
+
+const pageSize = 200
+
+// Link is the milestone/epic a task belongs to on one side.
+type Link struct {
+	MilestoneID int64 `json:"milestone_id"`
+	EpicID      int64 `json:"epic_id"`
+}
+
+type Mismatch struct {
+	TaskID int64 `json:"task_id"`
+	Local  Link  `json:"local"`
+	Remote Link  `json:"remote"`
+}
+
+type Orphan struct {
+	TaskID int64 `json:"task_id"`
+	Link
+}
+
+// Report lists the differences between task_entities and the task service.
+// Dangling are local rows whose task is gone remotely, Orphans are remote
+// tasks of our milestones without a local row. Tasks with pending outbox
+// entries are in flight and only counted as Skipped. Refreshed counts the
+// milestones whose done/started flags are out of date, repair brings them and
+// their task counts up to date. A run without repair changes nothing.
+type Report struct {
+	Checked    int        `json:"checked"`
+	Skipped    int        `json:"skipped"`
+	Refreshed  int        `json:"refreshed"`
+	Dangling   []int64    `json:"dangling"`
+	Orphans    []Orphan   `json:"orphans"`
+	Mismatched []Mismatch `json:"mismatched"`
+	Repaired   int        `json:"repaired"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+func (r Report) Clean() bool {
+	return len(r.Dangling) == 0 && len(r.Orphans) == 0 && len(r.Mismatched) == 0
+}
+
+type Reconciler struct {
+	db     *gorm.DB
+	client taskclient.Client
+	log    *logrus.Logger
+}
+
+func New(db *gorm.DB, client taskclient.Client, log *logrus.Logger) Reconciler {
+	return Reconciler{db: db, client: client, log: log}
+}
+
+// Run compares both sides and, with repair, fixes what it found: dangling rows
+// are deleted, orphans are adopted when their milestone exists, and for link
+// mismatches the task service wins when it points to a known milestone,
+// otherwise our link is pushed back to it.
+func (r Reconciler) Run(ctx context.Context, repair bool) (Report, error) {
+	var report Report
+	local := make(map[int64]tasks.TaskEntity)
+	remote := make(map[int64]models.Task)
+
+	taskRepo := tasks.New(r.db)
+	var afterID int64
+	for {
+		page, err := taskRepo.GetPage(afterID, pageSize)
+		if err != nil {
+			return report, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		ids := make([]int64, 0, len(page))
+		for _, t := range page {
+			local[t.ID] = t
+			ids = append(ids, t.ID)
+		}
+		afterID = page[len(page)-1].ID
+		// cached payloads would hide remote deletions
+		r.client.Invalidate(ids...)
+		fetched, err := r.client.Batch(ctx, ids)
+		if err != nil {
+			return report, err
+		}
+		for _, t := range fetched {
+			remote[t.ID] = t
+		}
+	}
+
+	miles, err := milestone.New(r.db).Find(milestone.Filter{})
+	if err != nil {
+		return report, err
+	}
+	known := make(map[int64]milestone.MilestoneEntity, len(miles))
+	for i := 0; i < len(miles); i += pageSize {
+		end := i + pageSize
+		if end > len(miles) {
+			end = len(miles)
+		}
+		ids := make([]int64, 0, end-i)
+		for _, m := range miles[i:end] {
+			known[m.MilestoneID] = m
+			ids = append(ids, m.MilestoneID)
+		}
+		listed, err := r.client.List(ctx, ids)
+		if err != nil {
+			return report, err
+		}
+		for _, t := range listed {
+			remote[t.ID] = t
+		}
+	}
+	pending, err := outbox.New(r.db).PendingTaskIDs()
+	if err != nil {
+		return report, err
+	}
+	report.Checked = len(local)
+
+	var synced []tasks.TaskEntity
+	var fetched []models.Task
+	for id, l := range local {
+		if pending[id] {
+			report.Skipped++
+			continue
+		}
+		rt, ok := remote[id]
+		if ok {
+			synced = append(synced, l)
+			fetched = append(fetched, rt)
+		}
+		if !ok {
+			report.Dangling = append(report.Dangling, id)
+			continue
+		}
+		if rt.MilestoneId != 0 && (rt.MilestoneId != l.MilestoneID || rt.EpicID != l.EpicID) {
+			report.Mismatched = append(report.Mismatched, Mismatch{
+				TaskID: id,
+				Local:  Link{MilestoneID: l.MilestoneID, EpicID: l.EpicID},
+				Remote: Link{MilestoneID: rt.MilestoneId, EpicID: rt.EpicID},
+			})
+		}
+	}
+	for id, rt := range remote {
+		if _, ok := local[id]; !ok && rt.MilestoneId != 0 && !pending[id] {
+			report.Orphans = append(report.Orphans, Orphan{TaskID: id, Link: Link{MilestoneID: rt.MilestoneId, EpicID: rt.EpicID}})
+		}
+	}
+
+	if !repair {
+		_, _, stale := progress.FlagChanges(synced, fetched)
+		report.Refreshed = len(stale)
+		return report, nil
+	}
+	refreshed, err := progress.SyncFlags(taskRepo, synced, fetched)
+	if err != nil {
+		return report, err
+	}
+	report.Refreshed = len(refreshed)
+	affected := make(map[int64]bool, len(refreshed))
+	for _, id := range refreshed {
+		affected[id] = true
+	}
+	if !report.Clean() {
+		r.repair(ctx, &report, local, remote, known, affected)
+	}
+	r.recount(affected)
+	return report, nil
+}
+
+// repair fixes the differences of the report and adds the milestones whose
+// tasks it changed to affected.
+func (r Reconciler) repair(ctx context.Context, report *Report, local map[int64]tasks.TaskEntity, remote map[int64]models.Task, known map[int64]milestone.MilestoneEntity, affected map[int64]bool) {
+	fail := func(taskID int64, err error) {
+		report.Errors = append(report.Errors, fmt.Sprintf("task %d: %v", taskID, err))
+	}
+	taskRepo := tasks.New(r.db)
+
+	for _, id := range report.Dangling {
+		if err := taskRepo.DeleteTask(id); err != nil {
+			fail(id, err)
+			continue
+		}
+		affected[local[id].MilestoneID] = true
+		report.Repaired++
+	}
+	for _, o := range report.Orphans {
+		if err := r.adopt(remote[o.TaskID], known); err != nil {
+			fail(o.TaskID, err)
+			continue
+		}
+		affected[o.MilestoneID] = true
+		report.Repaired++
+	}
+	for _, m := range report.Mismatched {
+		if _, ok := known[m.Remote.MilestoneID]; ok {
+			if err := r.adopt(remote[m.TaskID], known); err != nil {
+				fail(m.TaskID, err)
+				continue
+			}
+			affected[m.Remote.MilestoneID] = true
+		} else if err := r.client.Reparent(ctx, m.TaskID, m.Local.EpicID, m.Local.MilestoneID); err != nil {
+			fail(m.TaskID, err)
+			continue
+		}
+		affected[m.Local.MilestoneID] = true
+		report.Repaired++
+	}
+}
+
+// recount refreshes the cached task counts of the milestones.
+func (r Reconciler) recount(affected map[int64]bool) {
+	taskRepo := tasks.New(r.db)
+	ml := milestone.New(r.db)
+	for id := range affected {
+		done, total, err := taskRepo.CountByMilestoneID(id)
+		if err == nil {
+			err = ml.SetTaskCounts(id, done, total)
+		}
+		if err != nil {
+			r.log.Warnln("reconcile: can't recount milestone ", id, err)
+		}
+	}
+}
+
+// adopt stores the remote link of the task locally. An epic of another
+// milestone is dropped, the milestone is kept.
+func (r Reconciler) adopt(t models.Task, known map[int64]milestone.MilestoneEntity) error {
+	m, ok := known[t.MilestoneId]
+	if !ok {
+		return errors.New("unknown milestone")
+	}
+	entity := tasks.TaskEntity{
+		ID:           t.ID,
+		MilestoneID:  m.MilestoneID,
+		ActionPlanID: m.ActionPlanID,
+		Done:         progress.TaskDone(t),
+		Started:      progress.TaskStarted(t),
+	}
+	if t.EpicID > 0 {
+		if epic, err := epics.NewEpic(r.db).GetEpicByID(t.EpicID); err == nil && epic.MilestoneID == m.MilestoneID {
+			entity.EpicID = epic.ID
+		}
+	}
+	return tasks.New(r.db).Upsert(entity)
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"net/http"
 	"projects/internal/handlers/actionPlan"
+	"projects/internal/handlers/assignment"
+	"projects/internal/handlers/checklist"
 	"projects/internal/handlers/epic"
 	"projects/internal/handlers/milestone"
+	"projects/internal/handlers/overdue"
 	"projects/internal/handlers/processes"
 	"projects/internal/handlers/project"
+	"projects/internal/handlers/reports"
 	"projects/internal/handlers/stage"
+	"projects/internal/handlers/tags"
 	"projects/internal/handlers/task"
 	"projects/internal/handlers/template"
+	"projects/internal/handlers/webhook"
+	"projects/internal/handlers/workspace"
+	"projects/pkg/auth"
 	"projects/pkg/config"
 
 	"github.com/gin-gonic/gin"
@@ -27,13 +35,21 @@ var Module = fx.Options(
 type Params struct {
 	fx.In
 	Lifecycle  fx.Lifecycle
+	Auth       auth.Authenticator
 	ActionPlan actionPlan.ActionPlanHandler
+	Assignment assignment.AssignmentHandler
+	Checklist  checklist.ChecklistHandler
 	Epic       epic.EpicHandler
 	Milestone  milestone.MilestoneHandler
+	Overdue    overdue.OverdueHandler
 	Stage      stage.StageHandler
 	Processes  processes.ProcessesHandler
 	Project    project.ProjectHandler
+	Reports    reports.ReportsHandler
+	Tags       tags.TagsHandler
 	Task       task.TaskHandler
+	Webhook    webhook.WebhookHandler
+	Workspace  workspace.WorkspaceHandler
 	Template   template.TemplateHandler
 	*logrus.Logger
 	*config.Tuner
@@ -41,6 +57,11 @@ type Params struct {
 
 func SetupRouter(params Params) {
 	r := gin.Default()
+	r.Use(params.Auth.Middleware())
+
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
 
 	baseRoute := r.Group("/api/projects")
 	baseRoute.GET("", params.Project.GetProjects)
@@ -49,6 +70,12 @@ func SetupRouter(params Params) {
 	baseRoute.PUT("/new", params.Project.CreateProject)
 	baseRoute.DELETE("/delete/:id", params.Project.DeleteProject)
 
+	baseRoute.GET("/overdue", params.Overdue.GetOverdue)
+
+	reportsRoute := baseRoute.Group("/reports")
+	reportsRoute.GET("/processes", params.Reports.GetProcessReports)
+	reportsRoute.GET("/processes/:id", params.Reports.GetProcessReport)
+
 	baseRoute.GET("/:id/template", params.Template.GetTemplates)
 	baseRoute.POST("/:id/template", params.Template.UpdateTemplate)
 
@@ -57,6 +84,17 @@ func SetupRouter(params Params) {
 	baseRoute.PUT("/milestone", params.Milestone.CreateMilestone)
 	baseRoute.POST("/milestone/:id", params.Milestone.EditMilestone)
 	baseRoute.DELETE("/milestone/delete/:id", params.Milestone.DeleteMilestone)
+	baseRoute.POST("/milestone/move/:id", params.Milestone.MoveMilestone)
+	baseRoute.POST("/milestone/bulk", params.Milestone.BulkUpdateMilestones)
+	baseRoute.GET("/milestone/history/:id", params.Milestone.GetStatusHistory)
+	baseRoute.GET("/milestone/assignee/:id", params.Assignment.GetAssignees)
+	baseRoute.PUT("/milestone/assignee/:id", params.Assignment.AddAssignee)
+	baseRoute.DELETE("/milestone/assignee/:id", params.Assignment.RemoveAssignee)
+	baseRoute.GET("/milestone/my/:user_id", params.Assignment.GetMyMilestones)
+	baseRoute.GET("/milestone/checklist/:id", params.Checklist.GetChecklist)
+	baseRoute.PUT("/milestone/checklist/:id", params.Checklist.CreateItems)
+	baseRoute.POST("/milestone/checklist/item/:id", params.Checklist.UpdateItem)
+	baseRoute.DELETE("/milestone/checklist/item/:id", params.Checklist.DeleteItem)
 
 	baseRoute.POST("/acplan/create", params.ActionPlan.CreateActionPlan)
 	baseRoute.GET("/acplan/download/:id", params.ActionPlan.DownloadActionPlan)
@@ -74,11 +112,15 @@ func SetupRouter(params Params) {
 	baseRoute.POST("/epic/read", params.Epic.GetEpics)
 	baseRoute.POST("/epic/:id", params.Epic.UpdateEpic)
 	baseRoute.DELETE("/epic/:id", params.Epic.DeleteEpic)
+	baseRoute.POST("/epic/move/:id", params.Epic.MoveEpic)
 
 	taskRoute := baseRoute.Group("/tasks")
 	taskRoute.POST("", params.Task.CreateTask)
+	taskRoute.POST("/bulk", params.Task.BulkTasks)
 	// taskRoute.GET("/:task_id", params.Task.GetTask)
-	taskRoute.GET("", params.Task.GetTasksBatch)
+	taskRoute.GET("", params.Task.GetTasks)
+	taskRoute.GET("/client/metrics", params.Task.ClientMetrics)
+	taskRoute.GET("/outbox/:id", params.Task.GetOutboxEntry)
 	taskRoute.GET("/epic/:epic_id", params.Task.GetTaskByEpic)
 	taskRoute.GET("/milestone/:milestone_id", params.Task.GetTaskByMilestone)
 	taskRoute.GET("/:id", params.Task.GetTaskByID)
@@ -88,8 +130,37 @@ func SetupRouter(params Params) {
 	processesRoute := baseRoute.Group("/processes")
 	processesRoute.PUT("", params.Processes.CreateProcess)
 	processesRoute.GET("", params.Processes.ReadProcesses)
+	processesRoute.GET("/:id", params.Processes.GetProcess)
 	processesRoute.POST("/:id", params.Processes.UpdateProcess)
 	processesRoute.DELETE("/:id", params.Processes.DeleteProcess)
+	processesRoute.PUT("/:id/standard", params.Processes.SetStandard)
+	processesRoute.POST("/:id/milestones", params.Processes.LinkMilestones)
+	processesRoute.DELETE("/:id/milestones", params.Processes.UnlinkMilestones)
+
+	tagsRoute := baseRoute.Group("/tags")
+	tagsRoute.GET("", params.Tags.GetTags)
+	tagsRoute.PUT("", params.Tags.CreateTag)
+	tagsRoute.POST("/:id", params.Tags.UpdateTag)
+	tagsRoute.DELETE("/:id", params.Tags.DeleteTag)
+	tagsRoute.PUT("/:id/link", params.Tags.LinkTag)
+	tagsRoute.DELETE("/:id/link", params.Tags.UnlinkTag)
+	tagsRoute.GET("/entity/:type/:id", params.Tags.GetEntityTags)
+
+	baseRoute.POST("/webhooks/tasks", params.Webhook.TaskEvents)
+
+	workspaceRoute := baseRoute.Group("/workspaces")
+	workspaceRoute.GET("", params.Workspace.GetWorkspaces)
+	workspaceRoute.PUT("", params.Workspace.CreateWorkspace)
+	workspaceRoute.GET("/:id", params.Workspace.GetWorkspace)
+	workspaceRoute.POST("/:id", params.Workspace.UpdateWorkspace)
+	workspaceRoute.DELETE("/:id", params.Workspace.DeleteWorkspace)
+	workspaceRoute.GET("/:id/acplans", params.Workspace.GetActionPlans)
+	workspaceRoute.GET("/:id/stages", params.Workspace.GetStages)
+	workspaceRoute.GET("/:id/milestones", params.Workspace.GetMilestones)
+	workspaceRoute.GET("/:id/epics", params.Workspace.GetEpics)
+	workspaceRoute.GET("/:id/members", params.Workspace.GetMembers)
+	workspaceRoute.PUT("/:id/members", params.Workspace.SetMember)
+	workspaceRoute.DELETE("/:id/members/:user_id", params.Workspace.RemoveMember)
 
 	srv := http.Server{
 		Addr:    ":" + params.Config.Main.Port,
@@ -0,0 +1,38 @@
+package taskbackend
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+
+	"projects/pkg/config"
+	"projects/pkg/db"
+	"projects/pkg/taskclient"
+)
+
+var Module = fx.Provide(New)
+
+const (
+	Remote = "remote"
+	Native = "native"
+)
+
+type Params struct {
+	fx.In
+	db.DbInter
+	*config.Tuner
+	*logrus.Logger
+}
+
+// New returns the task backend chosen by Task.Backend: the remote task
+// service at Task.Addr (the default) or tasks stored in our own database.
+func New(params Params) (taskclient.Client, error) {
+	switch params.Tuner.Task.Backend {
+	case "", Remote:
+		return taskclient.New(taskclient.Params{Tuner: params.Tuner, Logger: params.Logger}), nil
+	case Native:
+		return NewNative(params.DbInter), nil
+	}
+	return nil, fmt.Errorf("unknown task backend %q", params.Tuner.Task.Backend)
+}
@@ -0,0 +1,208 @@
+package taskbackend
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"projects/internal/database/tasks"
+	"projects/internal/models"
+	"projects/internal/progress"
+	"projects/pkg/db"
+	"projects/pkg/taskclient"
+)
+
+// native keeps the full tasks in the task table, so no task service is needed.
+// Failures are reported as taskclient errors, handlers map them the same way.
+type native struct {
+	db db.DbInter
+}
+
+func NewNative(dbi db.DbInter) taskclient.Client {
+	return &native{db: dbi}
+}
+
+func (n *native) Get(_ context.Context, id int64) (models.Task, error) {
+	found, err := tasks.NewNative(n.db.GetDB()).GetByIDs([]int64{id})
+	if err != nil {
+		return models.Task{}, storeErr("get", err)
+	}
+	if len(found) == 0 {
+		return models.Task{}, &taskclient.Error{Op: "get", Kind: taskclient.ErrNotFound}
+	}
+	return toTask(found[0]), nil
+}
+
+func (n *native) Batch(_ context.Context, ids []int64) ([]models.Task, error) {
+	var res []models.Task
+	if len(ids) == 0 {
+		return res, nil
+	}
+	found, err := tasks.NewNative(n.db.GetDB()).GetByIDs(ids)
+	if err != nil {
+		return nil, storeErr("batch", err)
+	}
+	for _, t := range found {
+		res = append(res, toTask(t))
+	}
+	return res, nil
+}
+
+func (n *native) List(_ context.Context, milestoneIDs []int64) ([]models.Task, error) {
+	var res []models.Task
+	if len(milestoneIDs) == 0 {
+		return res, nil
+	}
+	found, err := tasks.NewNative(n.db.GetDB()).GetByMilestoneIDs(milestoneIDs)
+	if err != nil {
+		return nil, storeErr("list", err)
+	}
+	for _, t := range found {
+		res = append(res, toTask(t))
+	}
+	return res, nil
+}
+
+// Create applies a create carrying an idempotency key once, repeating it
+// returns the task created first.
+func (n *native) Create(ctx context.Context, task models.TaskReq) (models.Task, error) {
+	if task.Title == "" {
+		return models.Task{}, &taskclient.Error{Op: "create", Kind: taskclient.ErrBadRequest, Body: "title is required"}
+	}
+	entity := tasks.NativeTaskEntity{
+		MilestoneID: task.MilestoneID,
+		EpicID:      task.EpicID,
+		ProjectID:   task.ProjectID,
+		CompanyID:   task.CompanyID,
+		GroupID:     task.GroupId,
+		CreatorID:   task.CreatorID,
+		ReporterID:  task.ReporterID,
+		AssigneeID:  task.AssigneeID,
+		Title:       task.Title,
+		Description: task.Description,
+		Priority:    task.Priority,
+		Status:      task.Status,
+		StartTime:   task.StartTime,
+		EndTime:     task.EndTime,
+	}
+	if entity.Status == "" {
+		entity.Status = "new"
+	}
+	entity.ResolvedTime = resolvedTime(entity.Status, "")
+	if key := taskclient.IdempotencyKey(ctx); key != "" {
+		entity.IdempotencyKey = &key
+	}
+	if err := tasks.NewNative(n.db.GetDB()).CreateOnce(&entity); err != nil {
+		return models.Task{}, storeErr("create", err)
+	}
+	return toTask(entity), nil
+}
+
+// Update changes the non-empty fields of the request, like the handlers do
+// for our own entities.
+func (n *native) Update(ctx context.Context, id int64, task models.TaskReq) (models.Task, error) {
+	current, err := n.Get(ctx, id)
+	if err != nil {
+		return current, err
+	}
+	updateColumns := make(map[string]interface{})
+	set := func(column, value string) {
+		if value != "" {
+			updateColumns[column] = value
+		}
+	}
+	if task.MilestoneID > 0 {
+		updateColumns["milestone_id"] = task.MilestoneID
+	}
+	if task.EpicID > 0 {
+		updateColumns["epic_id"] = task.EpicID
+	}
+	set("project_id", task.ProjectID)
+	set("company_id", task.CompanyID)
+	set("group_id", task.GroupId)
+	set("reporter_id", task.ReporterID)
+	set("assignee_id", task.AssigneeID)
+	set("title", task.Title)
+	set("description", task.Description)
+	set("priority", task.Priority)
+	set("start_time", task.StartTime)
+	set("end_time", task.EndTime)
+	if task.Status != "" {
+		updateColumns["status"] = task.Status
+		updateColumns["resolved_time"] = resolvedTime(task.Status, current.ResolvedTime)
+	}
+
+	updated, err := tasks.NewNative(n.db.GetDB()).Update(id, updateColumns)
+	if err != nil {
+		return models.Task{}, storeErr("update", err)
+	}
+	return toTask(updated), nil
+}
+
+func (n *native) Reparent(_ context.Context, id, epicID, milestoneID int64) error {
+	_, err := tasks.NewNative(n.db.GetDB()).Update(id, map[string]interface{}{
+		"epic_id":      epicID,
+		"milestone_id": milestoneID,
+	})
+	return storeErr("update", err)
+}
+
+func (n *native) Delete(_ context.Context, id int64) error {
+	_, err := tasks.NewNative(n.db.GetDB()).Delete(id)
+	return storeErr("delete", err)
+}
+
+func (n *native) Invalidate(_ ...int64) {}
+
+func (n *native) Metrics() taskclient.Metrics {
+	return taskclient.Metrics{Backend: Native, Ops: map[string]taskclient.OpStats{}}
+}
+
+// resolvedTime keeps the resolve time while the task stays resolved.
+func resolvedTime(status, current string) string {
+	if !progress.TaskDone(models.Task{Status: status}) {
+		return ""
+	}
+	if current != "" {
+		return current
+	}
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func storeErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &taskclient.Error{Op: op, Kind: taskclient.ErrNotFound}
+	}
+	// data exceptions and constraint violations won't pass on a retry
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		if class := pgErr.SQLState(); strings.HasPrefix(class, "22") || strings.HasPrefix(class, "23") {
+			return &taskclient.Error{Op: op, Kind: taskclient.ErrBadRequest, Body: err.Error(), Err: err}
+		}
+	}
+	return &taskclient.Error{Op: op, Kind: taskclient.ErrUnavailable, Err: err}
+}
+
+func toTask(t tasks.NativeTaskEntity) models.Task {
+	return models.Task{
+		ID:           t.ID,
+		MilestoneId:  t.MilestoneID,
+		EpicID:       t.EpicID,
+		ProjectID:    t.ProjectID,
+		CreatorID:    t.CreatorID,
+		AssigneeId:   t.AssigneeID,
+		Title:        t.Title,
+		Description:  t.Description,
+		Priority:     t.Priority,
+		Status:       t.Status,
+		StartTime:    t.StartTime,
+		EndTime:      t.EndTime,
+		ResolvedTime: t.ResolvedTime,
+	}
+}
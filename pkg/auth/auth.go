@@ -0,0 +1,165 @@
+// Package auth validates the bearer token of incoming requests and puts the
+// caller into the gin context.
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"projects/pkg/config"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// gin context keys set for authenticated requests
+const (
+	UserKey    = "user_id"
+	CompanyKey = "company"
+	RolesKey   = "roles"
+)
+
+const (
+	defaultUserClaim    = "sub"
+	defaultCompanyClaim = "company"
+	defaultRolesClaim   = "roles"
+	defaultJWKSRefresh  = time.Hour
+)
+
+var ErrNoToken = errors.New("bearer token required")
+
+// Authenticator checks the Authorization header of every request except the
+// public paths. It lets everything through when Auth.Enabled is false.
+type Authenticator interface {
+	Middleware() gin.HandlerFunc
+}
+
+type Params struct {
+	fx.In
+	*config.Tuner
+	*logrus.Logger
+}
+
+type authenticator struct {
+	enabled  bool
+	verifier *verifier
+	public   []string
+	log      *logrus.Logger
+}
+
+func New(params Params) (Authenticator, error) {
+	conf := params.Tuner.Auth
+	a := &authenticator{enabled: conf.Enabled, log: params.Logger}
+	if !conf.Enabled {
+		params.Logger.Warnln("auth is disabled, every caller is anonymous and only open workspaces can be changed")
+		return a, nil
+	}
+	if conf.Secret == "" && conf.JWKS == "" {
+		return nil, errors.New("auth is enabled without Secret or JWKS")
+	}
+	a.verifier = &verifier{
+		secret:       []byte(conf.Secret),
+		issuer:       conf.Issuer,
+		audience:     conf.Audience,
+		leeway:       time.Duration(conf.Leeway) * time.Second,
+		userClaim:    orDefault(conf.UserClaim, defaultUserClaim),
+		companyClaim: orDefault(conf.CompanyClaim, defaultCompanyClaim),
+		rolesClaim:   orDefault(conf.RolesClaim, defaultRolesClaim),
+	}
+	if conf.JWKS != "" {
+		refresh := defaultJWKSRefresh
+		if conf.JWKSRefresh > 0 {
+			refresh = time.Duration(conf.JWKSRefresh) * time.Second
+		}
+		a.verifier.keys = newKeySet(conf.JWKS, refresh)
+		// an unreachable key server should not keep the service down, the keys
+		// are fetched again on the first token
+		if err := a.verifier.keys.load(); err != nil {
+			params.Logger.Warnln("load jwks err: ", err.Error())
+		}
+	}
+	for _, p := range strings.Split(conf.Public, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			a.public = append(a.public, p)
+		}
+	}
+	return a, nil
+}
+
+func (a *authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			c.Next()
+			return
+		}
+		if a.isPublic(c.Request.URL.Path) {
+			// the caller stays anonymous, see Authenticated
+			c.Set(UserKey, "")
+			c.Next()
+			return
+		}
+		token, err := bearer(c.GetHeader("Authorization"))
+		var claims Claims
+		if err == nil {
+			claims, err = a.verifier.verify(token, time.Now())
+		}
+		if err != nil {
+			a.log.Warnln("auth err: ", err.Error())
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(UserKey, claims.UserID)
+		c.Set(CompanyKey, claims.Company)
+		c.Set(RolesKey, claims.Roles)
+		c.Next()
+	}
+}
+
+// isPublic matches the path exactly, a trailing * matches a prefix.
+func (a *authenticator) isPublic(path string) bool {
+	for _, p := range a.public {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(path, strings.TrimSuffix(p, "*")) || p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticated reports whether the middleware handled the request, its
+// caller is then only the token subject.
+func Authenticated(c *gin.Context) bool {
+	_, ok := c.Get(UserKey)
+	return ok
+}
+
+func UserID(c *gin.Context) string {
+	return c.GetString(UserKey)
+}
+
+func Company(c *gin.Context) string {
+	return c.GetString(CompanyKey)
+}
+
+func Roles(c *gin.Context) []string {
+	return c.GetStringSlice(RolesKey)
+}
+
+func bearer(header string) (string, error) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", ErrNoToken
+	}
+	return strings.TrimSpace(header[len(prefix):]), nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
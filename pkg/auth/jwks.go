@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minReload limits fetches triggered by expired keys and tokens signed with an
+// unknown kid.
+const (
+	minReload   = 10 * time.Second
+	httpTimeout = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown token signing key")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// keySet holds the RSA and symmetric keys of a JWKS document read from a
+// file or an http(s) URL, reloaded every refresh.
+type keySet struct {
+	source  string
+	refresh time.Duration
+	http    *http.Client
+
+	mu      sync.RWMutex
+	rsaKeys map[string]*rsa.PublicKey
+	secrets map[string][]byte
+	loaded  time.Time
+	tried   time.Time
+	loading chan struct{}
+}
+
+func newKeySet(source string, refresh time.Duration) *keySet {
+	return &keySet{source: source, refresh: refresh, http: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *keySet) publicKey(kid string) (*rsa.PublicKey, error) {
+	s.ensure(func() bool { return only(s.rsaKeys, kid) != nil })
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key := only(s.rsaKeys, kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *keySet) secret(kid string) ([]byte, error) {
+	s.ensure(func() bool { return s.secrets[kid] != nil })
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key := s.secrets[kid]; key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// only returns the key of kid, or the single key when the token names none.
+func only(keys map[string]*rsa.PublicKey, kid string) *rsa.PublicKey {
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k
+		}
+	}
+	return keys[kid]
+}
+
+// ensure reloads expired keys, or keys missing the one asked for, at most once
+// every minReload. Only one load runs at a time and in the background: expired
+// keys keep serving meanwhile, a caller missing its key waits for the load.
+func (s *keySet) ensure(found func() bool) {
+	s.mu.Lock()
+	missing := !found()
+	due := missing || time.Since(s.loaded) > s.refresh
+	if due && s.loading == nil && time.Since(s.tried) > minReload {
+		s.tried = time.Now()
+		s.loading = make(chan struct{})
+		go s.reload(s.loading)
+	}
+	wait := s.loading
+	s.mu.Unlock()
+	if missing && wait != nil {
+		<-wait
+	}
+}
+
+func (s *keySet) reload(done chan struct{}) {
+	// a failed reload keeps the previous keys
+	s.load()
+	s.mu.Lock()
+	s.loading = nil
+	s.mu.Unlock()
+	close(done)
+}
+
+func (s *keySet) load() error {
+	s.mu.Lock()
+	s.tried = time.Now()
+	s.mu.Unlock()
+
+	raw, err := s.read()
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	rsaKeys := make(map[string]*rsa.PublicKey)
+	secrets := make(map[string][]byte)
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			key, err := rsaKey(k)
+			if err != nil {
+				return fmt.Errorf("jwks key %q: %w", k.Kid, err)
+			}
+			rsaKeys[k.Kid] = key
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return fmt.Errorf("jwks key %q: %w", k.Kid, err)
+			}
+			secrets[k.Kid] = secret
+		}
+	}
+
+	s.mu.Lock()
+	s.rsaKeys, s.secrets, s.loaded = rsaKeys, secrets, time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *keySet) read() ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return ioutil.ReadFile(strings.TrimPrefix(s.source, "file://"))
+	}
+	resp, err := s.http.Get(s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: %s answered %d", s.source, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("bad modulus or exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wait blocks until the running load of s, if any, is done.
+func (s *keySet) wait() {
+	s.mu.Lock()
+	done := s.loading
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func TestKeySetMissingKid(t *testing.T) {
+	dir := t.TempDir()
+	keyA, keyB := genKey(t), genKey(t)
+	s := newKeySet(writeJWKS(t, dir, rsaJWK("a", keyA)), time.Hour)
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	writeJWKS(t, dir, rsaJWK("a", keyA), rsaJWK("b", keyB))
+
+	// the last load is too recent to fetch again
+	if _, err := s.publicKey("b"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownKey)
+	}
+	s.tried = time.Now().Add(-2 * minReload)
+	if _, err := s.publicKey("b"); err != nil {
+		t.Fatalf("err = %v after the throttle", err)
+	}
+}
+
+func TestKeySetExpired(t *testing.T) {
+	dir := t.TempDir()
+	keyA, keyB := genKey(t), genKey(t)
+	s := newKeySet(writeJWKS(t, dir, rsaJWK("a", keyA)), time.Hour)
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	writeJWKS(t, dir, rsaJWK("b", keyB))
+	s.loaded = time.Now().Add(-2 * time.Hour)
+
+	// not throttled yet, the expired keys stay in use
+	if _, err := s.publicKey("a"); err != nil {
+		t.Fatalf("err = %v while throttled", err)
+	}
+	s.tried = time.Now().Add(-2 * minReload)
+	// the old key still answers while the reload runs in the background
+	if _, err := s.publicKey("a"); err != nil {
+		t.Fatalf("err = %v during the reload", err)
+	}
+	s.wait()
+	if _, err := s.publicKey("b"); err != nil {
+		t.Fatalf("err = %v after the reload", err)
+	}
+	if _, err := s.publicKey("a"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want the removed key unknown", err)
+	}
+}
+
+func TestKeySetSingleLoader(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer srv.Close()
+
+	s := newKeySet(srv.URL, time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.publicKey("missing")
+		}()
+	}
+	// give every caller the chance to start its own load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	s.wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetches = %d, want 1", n)
+	}
+}
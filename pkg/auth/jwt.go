@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrAlgorithm   = errors.New("unsupported token algorithm")
+	ErrSignature   = errors.New("invalid token signature")
+	ErrExpired     = errors.New("token expired or without exp")
+	ErrNotYetValid = errors.New("token not valid yet")
+	ErrClaims      = errors.New("token issuer, audience or subject mismatch")
+)
+
+// Claims is the caller of an authenticated request.
+type Claims struct {
+	UserID  string
+	Company string
+	Roles   []string
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type verifier struct {
+	secret   []byte
+	keys     *keySet
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	userClaim    string
+	companyClaim string
+	rolesClaim   string
+}
+
+// verify checks a compact JWS signed with HS256 or RS256 and its registered
+// claims, exp is required.
+func (v *verifier) verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	if err := v.checkSignature(h, parts[0]+"."+parts[1], sig); err != nil {
+		return Claims{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return Claims{}, ErrExpired
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return Claims{}, ErrExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return Claims{}, ErrNotYetValid
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return Claims{}, ErrClaims
+	}
+	if v.audience != "" && !contains(strList(claims["aud"]), v.audience) {
+		return Claims{}, ErrClaims
+	}
+
+	res := Claims{
+		UserID:  str(lookup(claims, v.userClaim)),
+		Company: str(lookup(claims, v.companyClaim)),
+		Roles:   strList(lookup(claims, v.rolesClaim)),
+	}
+	if res.UserID == "" {
+		return Claims{}, ErrClaims
+	}
+	return res, nil
+}
+
+func (v *verifier) checkSignature(h header, signed string, sig []byte) error {
+	switch h.Alg {
+	case "HS256":
+		secret := v.secret
+		if len(secret) == 0 && v.keys != nil {
+			var err error
+			if secret, err = v.keys.secret(h.Kid); err != nil {
+				return err
+			}
+		}
+		if len(secret) == 0 {
+			return ErrAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrSignature
+		}
+		return nil
+	case "RS256":
+		if v.keys == nil {
+			return ErrAlgorithm
+		}
+		key, err := v.keys.publicKey(h.Kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return ErrSignature
+		}
+		return nil
+	}
+	return ErrAlgorithm
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// lookup follows a dotted claim name into nested objects, e.g. realm_access.roles.
+func lookup(claims map[string]interface{}, name string) interface{} {
+	var cur interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// strList reads a claim holding a list of strings or a single string.
+func strList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var res []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+var testNow = time.Unix(1700000000, 0)
+
+func segment(t *testing.T, v interface{}) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// hs256 signs claims with the secret, the header may override alg and kid.
+func hs256(t *testing.T, secret []byte, h header, claims map[string]interface{}) string {
+	t.Helper()
+	if h.Alg == "" {
+		h.Alg = "HS256"
+	}
+	signed := segment(t, h) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := segment(t, header{Alg: "RS256", Kid: kid}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// writeJWKS writes the keys to a file of dir and returns its path.
+func writeJWKS(t *testing.T, dir string, keys ...jwk) string {
+	t.Helper()
+	raw, err := json.Marshal(map[string][]jwk{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func genKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// claimsAt returns valid claims expiring offset after testNow, extra values
+// override them and nil values remove them.
+func claimsAt(offset time.Duration, extra map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": "u1",
+		"iss": "issuer",
+		"aud": "projects",
+		"exp": testNow.Add(offset).Unix(),
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func secretVerifier() *verifier {
+	return &verifier{
+		secret:       []byte(testSecret),
+		issuer:       "issuer",
+		audience:     "projects",
+		leeway:       30 * time.Second,
+		userClaim:    defaultUserClaim,
+		companyClaim: defaultCompanyClaim,
+		rolesClaim:   "realm.roles",
+	}
+}
+
+func TestVerifySecret(t *testing.T) {
+	secret := []byte(testSecret)
+	tests := []struct {
+		name  string
+		token string
+		want  Claims
+		err   error
+	}{
+		{
+			name: "valid",
+			token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{
+				"company": "acme",
+				"realm":   map[string]interface{}{"roles": []string{"admin", "viewer"}},
+			})),
+			want: Claims{UserID: "u1", Company: "acme", Roles: []string{"admin", "viewer"}},
+		},
+		{name: "malformed", token: "a.b", err: ErrMalformed},
+		{name: "bad base64 signature", token: hs256(t, secret, header{}, claimsAt(time.Hour, nil)) + "*", err: ErrMalformed},
+		{name: "wrong secret", token: hs256(t, []byte("other"), header{}, claimsAt(time.Hour, nil)), err: ErrSignature},
+		{
+			name:  "alg none",
+			token: segment(t, header{Alg: "none"}) + "." + segment(t, claimsAt(time.Hour, nil)) + ".",
+			err:   ErrAlgorithm,
+		},
+		{name: "alg none signed", token: hs256(t, secret, header{Alg: "none"}, claimsAt(time.Hour, nil)), err: ErrAlgorithm},
+		{name: "rs256 without key set", token: hs256(t, secret, header{Alg: "RS256"}, claimsAt(time.Hour, nil)), err: ErrAlgorithm},
+		{name: "no exp", token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"exp": nil})), err: ErrExpired},
+		{name: "expired", token: hs256(t, secret, header{}, claimsAt(-time.Minute, nil)), err: ErrExpired},
+		{name: "expired within leeway", token: hs256(t, secret, header{}, claimsAt(-20*time.Second, nil)), want: Claims{UserID: "u1"}},
+		{
+			name:  "not yet valid",
+			token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()})),
+			err:   ErrNotYetValid,
+		},
+		{
+			name:  "nbf within leeway",
+			token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"nbf": testNow.Add(20 * time.Second).Unix()})),
+			want:  Claims{UserID: "u1"},
+		},
+		{
+			name:  "audience list",
+			token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"aud": []string{"other", "projects"}})),
+			want:  Claims{UserID: "u1"},
+		},
+		{name: "wrong audience", token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"aud": "other"})), err: ErrClaims},
+		{
+			name:  "wrong audience list",
+			token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"aud": []string{"a", "b"}})),
+			err:   ErrClaims,
+		},
+		{name: "no audience", token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"aud": nil})), err: ErrClaims},
+		{name: "wrong issuer", token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"iss": "other"})), err: ErrClaims},
+		{name: "no subject", token: hs256(t, secret, header{}, claimsAt(time.Hour, map[string]interface{}{"sub": nil})), err: ErrClaims},
+	}
+	v := secretVerifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.verify(tt.token, testNow)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if got.UserID != tt.want.UserID || got.Company != tt.want.Company || len(got.Roles) != len(tt.want.Roles) {
+				t.Fatalf("claims = %+v, want %+v", got, tt.want)
+			}
+			for i := range got.Roles {
+				if got.Roles[i] != tt.want.Roles[i] {
+					t.Fatalf("roles = %v, want %v", got.Roles, tt.want.Roles)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyKeySet(t *testing.T) {
+	keyA, keyB := genKey(t), genKey(t)
+	rsaOnly := newKeySet(writeJWKS(t, t.TempDir(), rsaJWK("a", keyA), rsaJWK("b", keyB)), time.Hour)
+	if err := rsaOnly.load(); err != nil {
+		t.Fatal(err)
+	}
+	single := newKeySet(writeJWKS(t, t.TempDir(), rsaJWK("a", keyA)), time.Hour)
+	if err := single.load(); err != nil {
+		t.Fatal(err)
+	}
+	oct := jwk{Kty: "oct", Kid: "h", K: base64.RawURLEncoding.EncodeToString([]byte(testSecret))}
+	mixed := newKeySet(writeJWKS(t, t.TempDir(), rsaJWK("a", keyA), oct), time.Hour)
+	if err := mixed.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := claimsAt(time.Hour, nil)
+	tests := []struct {
+		name  string
+		keys  *keySet
+		token string
+		err   error
+	}{
+		{name: "rs256 kid a", keys: rsaOnly, token: rs256(t, keyA, "a", valid)},
+		{name: "rs256 kid b", keys: rsaOnly, token: rs256(t, keyB, "b", valid)},
+		{name: "rs256 signed by another kid", keys: rsaOnly, token: rs256(t, keyA, "b", valid), err: ErrSignature},
+		{name: "rs256 unknown kid", keys: rsaOnly, token: rs256(t, keyA, "c", valid), err: ErrUnknownKey},
+		{name: "rs256 no kid with many keys", keys: rsaOnly, token: rs256(t, keyA, "", valid), err: ErrUnknownKey},
+		{name: "rs256 no kid with one key", keys: single, token: rs256(t, keyA, "", valid)},
+		{name: "rs256 expired", keys: rsaOnly, token: rs256(t, keyA, "a", claimsAt(-time.Hour, nil)), err: ErrExpired},
+		{
+			// the public key used as HMAC secret must not pass
+			name:  "hs256 against rsa keys",
+			keys:  rsaOnly,
+			token: hs256(t, keyA.N.Bytes(), header{Kid: "a"}, valid),
+			err:   ErrUnknownKey,
+		},
+		{name: "alg none", keys: rsaOnly, token: segment(t, header{Alg: "none", Kid: "a"}) + "." + segment(t, valid) + ".", err: ErrAlgorithm},
+		{name: "hs256 oct key", keys: mixed, token: hs256(t, []byte(testSecret), header{Kid: "h"}, valid)},
+		{name: "hs256 oct key wrong secret", keys: mixed, token: hs256(t, []byte("other"), header{Kid: "h"}, valid), err: ErrSignature},
+		{name: "rs256 kid of an oct key", keys: mixed, token: rs256(t, keyA, "h", valid), err: ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := secretVerifier()
+			v.secret, v.keys = nil, tt.keys
+			got, err := v.verify(tt.token, testNow)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && got.UserID != "u1" {
+				t.Fatalf("user = %q, want u1", got.UserID)
+			}
+		})
+	}
+}
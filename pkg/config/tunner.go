@@ -133,6 +133,12 @@ func (t *Tuner) switchType(v3 reflect.Value, str string) error {
 			return err
 		}
 		v3.SetInt(num)
+	case reflect.TypeOf(true):
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v3.SetBool(b)
 	case reflect.TypeOf(0.1):
 		num, err := strconv.ParseFloat(str, 64)
 		if err != nil {
@@ -0,0 +1,30 @@
+// Package dates parses the date strings stored for milestones, stages and
+// tasks.
+package dates
+
+import "time"
+
+// layouts are the date_start/date_stop formats sent by the frontend.
+var layouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"02.01.2006",
+}
+
+// Parse parses a stored date in any of the known layouts and drops the time
+// of day.
+func Parse(value string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Day(t), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Day returns midnight UTC of the day of t.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
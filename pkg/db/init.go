@@ -11,12 +11,18 @@ import (
 	"gorm.io/gorm/logger"
 
 	"projects/internal/database/actionPlan"
+	"projects/internal/database/assignment"
+	"projects/internal/database/checklist"
 	"projects/internal/database/epics"
+	"projects/internal/database/membership"
 	"projects/internal/database/milestone"
+	"projects/internal/database/outbox"
 	"projects/internal/database/processes"
 	"projects/internal/database/projects"
 	"projects/internal/database/stage"
+	"projects/internal/database/tags"
 	"projects/internal/database/tasks"
+	"projects/internal/database/webhook"
 	"projects/internal/database/workspace"
 	"projects/pkg/config"
 )
@@ -130,6 +136,15 @@ func autoMigrate(db *gorm.DB) error {
 	if err := addAcStatusEnum(db); err != nil {
 		return err
 	}
+	if err := addAssignRoleEnum(db); err != nil {
+		return err
+	}
+	if err := addOutboxStatusEnum(db); err != nil {
+		return err
+	}
+	if err := addWSRoleEnum(db); err != nil {
+		return err
+	}
 
 	projectTypes, err := db.Migrator().ColumnTypes(projects.ProjectEntity{})
 	if err != nil {
@@ -177,20 +192,47 @@ func autoMigrate(db *gorm.DB) error {
 
 	for _, model := range []interface{}{
 		(*workspace.WorkspaceEntity)(nil),
+		(*membership.MemberEntity)(nil),
 		(*actionPlan.ActionPlanEntity)(nil),
 		(*projects.PhaseEntity)(nil),
 		(*projects.ProjectEntity)(nil),
 		(*stage.StageEntity)(nil),
 		(*milestone.MilestoneEntity)(nil),
+		(*milestone.StatusHistoryEntity)(nil),
+		(*assignment.AssignmentEntity)(nil),
+		(*checklist.ChecklistItemEntity)(nil),
 		(*epics.EpicEntity)(nil),
 		(*tasks.TaskEntity)(nil),
+		(*tasks.NativeTaskEntity)(nil),
 		(*processes.ProcessEntity)(nil),
+		(*processes.StandardEpicEntity)(nil),
+		(*processes.StandardTaskEntity)(nil),
+		(*tags.TagEntity)(nil),
+		(*tags.TagLinkEntity)(nil),
+		(*webhook.EventEntity)(nil),
+		(*webhook.TaskStateEntity)(nil),
+		(*outbox.EntryEntity)(nil),
 	} {
 		dbSilent := db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
 		if err := dbSilent.AutoMigrate(model); err != nil {
 			return err
 		}
 	}
+	// outbox entries used to keep the caller's token, the worker sends with the service token now
+	if db.Migrator().HasColumn(&outbox.EntryEntity{}, "authorization") {
+		if err := db.Migrator().DropColumn(&outbox.EntryEntity{}, "authorization"); err != nil {
+			return err
+		}
+	}
+	// single assign_id values predate assignments, keep them as owners
+	if err := db.Exec(fmt.Sprintf(`
+		INSERT INTO milestone_assignment (milestone_id, user_id, role, created)
+		SELECT m.milestone_id, m.assign_id, '%s', extract(epoch from now())::bigint FROM milestone m
+		WHERE m.assign_id <> '' AND NOT EXISTS (
+			SELECT 1 FROM milestone_assignment ma WHERE ma.milestone_id = m.milestone_id AND ma.role = '%s')
+	`, assignment.Owner, assignment.Owner)).Error; err != nil {
+		return err
+	}
 	if err := db.Where("name = 'building&launch'").FirstOrCreate(&projects.PhaseEntity{Name: "building&launch"}).Error; err != nil {
 		return err
 	}
@@ -252,3 +294,51 @@ func addAcStatusEnum(db *gorm.DB) error {
 		LANGUAGE plpgsql;
 	`, actionPlan.Active, actionPlan.Archived, actionPlan.Draft)).Error
 }
+
+func addAssignRoleEnum(db *gorm.DB) error {
+	return db.Exec(fmt.Sprintf(`
+		DO
+		$$
+		BEGIN
+			IF NOT EXISTS (SELECT * FROM pg_type typ
+				INNER JOIN pg_namespace nsp ON nsp.oid = typ.typnamespace
+				WHERE nsp.nspname = current_schema() AND typ.typname = 'enum_assign_role') THEN
+				CREATE TYPE enum_assign_role AS ENUM('%s', '%s', '%s');
+			END IF;
+		END;
+		$$
+		LANGUAGE plpgsql;
+	`, assignment.Owner, assignment.Contributor, assignment.Reviewer)).Error
+}
+
+func addOutboxStatusEnum(db *gorm.DB) error {
+	return db.Exec(fmt.Sprintf(`
+		DO
+		$$
+		BEGIN
+			IF NOT EXISTS (SELECT * FROM pg_type typ
+				INNER JOIN pg_namespace nsp ON nsp.oid = typ.typnamespace
+				WHERE nsp.nspname = current_schema() AND typ.typname = 'enum_outbox_status') THEN
+				CREATE TYPE enum_outbox_status AS ENUM('%s', '%s', '%s');
+			END IF;
+		END;
+		$$
+		LANGUAGE plpgsql;
+	`, outbox.Pending, outbox.Done, outbox.Failed)).Error
+}
+
+func addWSRoleEnum(db *gorm.DB) error {
+	return db.Exec(fmt.Sprintf(`
+		DO
+		$$
+		BEGIN
+			IF NOT EXISTS (SELECT * FROM pg_type typ
+				INNER JOIN pg_namespace nsp ON nsp.oid = typ.typnamespace
+				WHERE nsp.nspname = current_schema() AND typ.typname = 'enum_ws_role') THEN
+				CREATE TYPE enum_ws_role AS ENUM('%s', '%s', '%s');
+			END IF;
+		END;
+		$$
+		LANGUAGE plpgsql;
+	`, membership.Viewer, membership.Editor, membership.Admin)).Error
+}
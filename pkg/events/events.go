@@ -0,0 +1,95 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewBus)
+
+const (
+	MilestoneOverdue = "milestone.overdue"
+	StageOverdue     = "stage.overdue"
+
+	// MilestoneStatusChanged carries the milestone.MilestoneEntity after the change
+	MilestoneStatusChanged = "milestone.status_changed"
+	// MilestoneCompletionProposed carries the milestone.MilestoneEntity whose tasks are all resolved
+	MilestoneCompletionProposed = "milestone.completion_proposed"
+	// MilestoneTasksChanged carries the int64 id of a milestone whose task states changed
+	MilestoneTasksChanged = "milestone.tasks_changed"
+	// MilestoneProcessLinked carries the milestone.MilestoneEntity newly linked to its process
+	MilestoneProcessLinked = "milestone.process_linked"
+)
+
+// Caller is who caused an event, empty for jobs. Handlers use it for the task
+// service calls they queue.
+type Caller struct {
+	Authorization string
+	UserID        string
+	Company       string
+}
+
+type Event struct {
+	Name    string
+	Payload interface{}
+	Caller  Caller
+	Created int64
+}
+
+type Handler func(e Event)
+
+// Bus is an in-process publish/subscribe hub. Handlers run synchronously in the
+// publisher goroutine, a panicking handler is logged and skipped.
+type Bus interface {
+	Publish(name string, payload interface{})
+	PublishAs(name string, payload interface{}, caller Caller)
+	Subscribe(name string, h Handler)
+}
+
+type Params struct {
+	fx.In
+	*logrus.Logger
+}
+
+type bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	log      *logrus.Logger
+}
+
+func NewBus(params Params) Bus {
+	return &bus{handlers: make(map[string][]Handler), log: params.Logger}
+}
+
+func (b *bus) Subscribe(name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], h)
+}
+
+func (b *bus) Publish(name string, payload interface{}) {
+	b.PublishAs(name, payload, Caller{})
+}
+
+func (b *bus) PublishAs(name string, payload interface{}, caller Caller) {
+	b.mu.RLock()
+	handlers := b.handlers[name]
+	b.mu.RUnlock()
+
+	e := Event{Name: name, Payload: payload, Caller: caller, Created: time.Now().Unix()}
+	for _, h := range handlers {
+		b.call(h, e)
+	}
+}
+
+func (b *bus) call(h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Warnln("event handler panic: ", e.Name, r)
+		}
+	}()
+	h(e)
+}
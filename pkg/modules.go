@@ -1,15 +1,21 @@
 package pkg
 
 import (
+	"projects/pkg/auth"
 	"projects/pkg/config"
 	"projects/pkg/db"
+	"projects/pkg/events"
 	"projects/pkg/logger"
+	"projects/pkg/scheduler"
 
 	"go.uber.org/fx"
 )
 
 var Modules = fx.Options(
+	auth.Module,
 	config.Module,
 	db.Module,
+	events.Module,
 	logger.Module,
+	scheduler.Module,
 )
@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+type Job func(ctx context.Context) error
+
+// Scheduler runs registered jobs periodically between the fx start and stop hooks.
+type Scheduler interface {
+	Every(name string, interval time.Duration, job Job)
+}
+
+type Params struct {
+	fx.In
+	Lifecycle fx.Lifecycle
+	*logrus.Logger
+}
+
+type entry struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	entries []entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	log     *logrus.Logger
+}
+
+func New(params Params) Scheduler {
+	s := &scheduler{log: params.Logger}
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			s.start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return s.stop(ctx)
+		},
+	})
+	return s
+}
+
+func (s *scheduler) Every(name string, interval time.Duration, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := entry{name: name, interval: interval, job: job}
+	s.entries = append(s.entries, e)
+	if s.ctx != nil {
+		s.run(e)
+	}
+}
+
+func (s *scheduler) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, e := range s.entries {
+		s.run(e)
+	}
+	s.log.Info("Scheduler started")
+}
+
+func (s *scheduler) stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.log.Info("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *scheduler) run(e entry) {
+	ctx := s.ctx
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			s.exec(ctx, e)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *scheduler) exec(ctx context.Context, e entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Warnln("job panic: ", e.name, r)
+		}
+	}()
+	if err := e.job(ctx); err != nil {
+		s.log.Warnln("job err: ", e.name, err)
+	}
+}
@@ -0,0 +1,77 @@
+package taskclient
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	stateClosed   = "closed"
+	stateOpen     = "open"
+	stateHalfOpen = "half-open"
+)
+
+// breaker opens after threshold consecutive failures and rejects calls until
+// cooldown has passed. Then a single probe is let through, its result closes
+// the breaker again or restarts the cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, state: stateClosed, now: time.Now}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.probing = true
+		return true
+	case stateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// done records the outcome of an allowed call and reports whether the
+// breaker has just opened.
+func (b *breaker) done(success bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.state = stateClosed
+		return false
+	}
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		opened := b.state != stateOpen
+		b.state = stateOpen
+		b.openedAt = b.now()
+		return opened
+	}
+	return false
+}
+
+func (b *breaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
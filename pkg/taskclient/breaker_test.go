@@ -0,0 +1,111 @@
+package taskclient
+
+import (
+	"testing"
+	"time"
+)
+
+// step is one call against the breaker: the clock moves by advance, allow is
+// asked and an allowed call ends with success. opened is what done reports.
+type step struct {
+	advance time.Duration
+	success bool
+	allowed bool
+	opened  bool
+	state   string
+}
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 30 * time.Second
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{allowed: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+				{allowed: true, success: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+			},
+		},
+		{
+			name: "opens at the threshold and rejects during the cooldown",
+			steps: []step{
+				{allowed: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+				{allowed: true, opened: true, state: stateOpen},
+				{allowed: false, state: stateOpen},
+				{advance: cooldown - time.Second, allowed: false, state: stateOpen},
+			},
+		},
+		{
+			name: "a successful probe closes",
+			steps: []step{
+				{allowed: true},
+				{allowed: true},
+				{allowed: true, opened: true, state: stateOpen},
+				{advance: cooldown, allowed: true, success: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+				{allowed: true, state: stateClosed},
+			},
+		},
+		{
+			name: "a failed probe restarts the cooldown",
+			steps: []step{
+				{allowed: true},
+				{allowed: true},
+				{allowed: true, opened: true, state: stateOpen},
+				{advance: cooldown, allowed: true, opened: true, state: stateOpen},
+				{advance: cooldown - time.Second, allowed: false, state: stateOpen},
+				{advance: time.Second, allowed: true, success: true, state: stateClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			b := newBreaker(3, cooldown)
+			b.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				if got := b.allow(); got != s.allowed {
+					t.Fatalf("step %d: allow = %v, want %v", i, got, s.allowed)
+				}
+				if s.allowed {
+					if got := b.done(s.success); got != s.opened {
+						t.Fatalf("step %d: opened = %v, want %v", i, got, s.opened)
+					}
+				}
+				if s.state != "" && b.current() != s.state {
+					t.Fatalf("step %d: state = %s, want %s", i, b.current(), s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+	b.allow()
+	b.done(false)
+
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("probe rejected after the cooldown")
+	}
+	if b.current() != stateHalfOpen {
+		t.Fatalf("state = %s, want %s", b.current(), stateHalfOpen)
+	}
+	if b.allow() {
+		t.Fatal("second call allowed while the probe runs")
+	}
+	b.done(true)
+	if !b.allow() {
+		t.Fatal("call rejected after the probe succeeded")
+	}
+}
@@ -0,0 +1,343 @@
+package taskclient
+
+import (
+	"context"
+	"projects/internal/models"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const maxCacheEntries = 50000
+
+// CacheStats are the counters of the task cache.
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Stale   int64 `json:"stale"`
+	Misses  int64 `json:"misses"`
+	Refresh int64 `json:"refresh_errors"`
+}
+
+type cacheEntry struct {
+	task    models.Task
+	fetched time.Time
+}
+
+type cacheKey struct {
+	company string
+	id      int64
+}
+
+// cached is a read-through cache of task payloads keyed by company and task
+// ID, a payload fetched for one company is never served to another. Entries
+// younger than ttl are served as is, entries up to ttl+stale old are served
+// immediately and refreshed in the background, so reads keep working while
+// the task service is down. Our own writes update or drop the entries.
+//
+// Every write bumps gen and marks its tasks invalidated at it. A fetch
+// remembers gen when it starts and does not store tasks invalidated since,
+// so a read racing a write can't put the old payload back.
+type cached struct {
+	Client
+	ttl   time.Duration
+	stale time.Duration
+	log   *logrus.Logger
+
+	mu          sync.Mutex
+	entries     map[int64]map[string]cacheEntry
+	size        int
+	refreshing  map[cacheKey]bool
+	gen         uint64
+	fetching    int
+	invalidated map[int64]uint64
+	stats       CacheStats
+	now         func() time.Time
+}
+
+func newCached(inner Client, ttl, stale time.Duration, log *logrus.Logger) *cached {
+	return &cached{
+		Client:      inner,
+		ttl:         ttl,
+		stale:       stale,
+		log:         log,
+		entries:     make(map[int64]map[string]cacheEntry),
+		refreshing:  make(map[cacheKey]bool),
+		invalidated: make(map[int64]uint64),
+		now:         time.Now,
+	}
+}
+
+func (c *cached) Get(ctx context.Context, id int64) (models.Task, error) {
+	comp := company(ctx)
+	fresh, stale, _ := c.lookup(comp, []int64{id})
+	if len(fresh) > 0 {
+		return fresh[0], nil
+	}
+	if len(stale) > 0 {
+		c.revalidate(ctx, []int64{id})
+		return stale[0], nil
+	}
+	start := c.begin()
+	task, err := c.Client.Get(ctx, id)
+	if err != nil {
+		c.finish(comp, start)
+		return task, err
+	}
+	c.finish(comp, start, task)
+	return task, nil
+}
+
+// Batch answers from the cache and fetches the misses. While the task service
+// is down the cached tasks are returned without the missing ones, the error
+// only when nothing was cached.
+func (c *cached) Batch(ctx context.Context, ids []int64) ([]models.Task, error) {
+	comp := company(ctx)
+	fresh, stale, missing := c.lookup(comp, ids)
+	res := append(fresh, stale...)
+	if len(missing) > 0 {
+		start := c.begin()
+		fetched, err := c.Client.Batch(ctx, missing)
+		switch {
+		case err == nil:
+			c.finish(comp, start, fetched...)
+			res = append(res, fetched...)
+		case Temporary(err) && len(res) > 0:
+			c.finish(comp, start)
+			c.log.Warnln("taskclient: serving cached tasks only", err)
+		default:
+			c.finish(comp, start)
+			return nil, err
+		}
+	}
+	if len(stale) > 0 {
+		staleIDs := make([]int64, 0, len(stale))
+		for _, t := range stale {
+			staleIDs = append(staleIDs, t.ID)
+		}
+		c.revalidate(ctx, staleIDs)
+	}
+	return res, nil
+}
+
+// List always asks the task service, its result refreshes the cached payloads.
+func (c *cached) List(ctx context.Context, milestoneIDs []int64) ([]models.Task, error) {
+	start := c.begin()
+	res, err := c.Client.List(ctx, milestoneIDs)
+	if err != nil {
+		c.finish(company(ctx), start)
+		return res, err
+	}
+	c.finish(company(ctx), start, res...)
+	return res, nil
+}
+
+func (c *cached) Create(ctx context.Context, task models.TaskReq) (models.Task, error) {
+	created, err := c.Client.Create(ctx, task)
+	if err == nil {
+		c.written(company(ctx), created.ID, created)
+	}
+	return created, err
+}
+
+// Update drops the task before the call, reads started meanwhile can't store
+// it, and keeps the answer of the task service afterwards.
+func (c *cached) Update(ctx context.Context, id int64, task models.TaskReq) (models.Task, error) {
+	c.Invalidate(id)
+	updated, err := c.Client.Update(ctx, id, task)
+	if err == nil && updated.ID == id {
+		c.written(company(ctx), id, updated)
+	} else {
+		c.Invalidate(id)
+	}
+	return updated, err
+}
+
+func (c *cached) Reparent(ctx context.Context, id, epicID, milestoneID int64) error {
+	c.Invalidate(id)
+	defer c.Invalidate(id)
+	return c.Client.Reparent(ctx, id, epicID, milestoneID)
+}
+
+func (c *cached) Delete(ctx context.Context, id int64) error {
+	c.Invalidate(id)
+	defer c.Invalidate(id)
+	return c.Client.Delete(ctx, id)
+}
+
+func (c *cached) Invalidate(ids ...int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(ids...)
+}
+
+func (c *cached) Metrics() Metrics {
+	m := c.Client.Metrics()
+	c.mu.Lock()
+	stats := c.stats
+	stats.Entries = c.size
+	c.mu.Unlock()
+	m.Cache = &stats
+	return m
+}
+
+// drop removes the tasks for every company and marks them invalidated for the
+// fetches running now. The caller holds mu.
+func (c *cached) drop(ids ...int64) {
+	c.gen++
+	for _, id := range ids {
+		c.size -= len(c.entries[id])
+		delete(c.entries, id)
+		if c.fetching > 0 {
+			c.invalidated[id] = c.gen
+		}
+	}
+}
+
+// written replaces the task by the payload our own write returned.
+func (c *cached) written(comp string, id int64, task models.Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(id)
+	c.put(comp, c.now(), task)
+}
+
+// lookup splits ids into fresh hits, stale hits and misses of the company.
+func (c *cached) lookup(comp string, ids []int64) (fresh, stale []models.Task, missing []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, id := range ids {
+		e, ok := c.entries[id][comp]
+		age := now.Sub(e.fetched)
+		switch {
+		case ok && age <= c.ttl:
+			fresh = append(fresh, e.task)
+			c.stats.Hits++
+		case ok && age <= c.ttl+c.stale:
+			stale = append(stale, e.task)
+			c.stats.Stale++
+		default:
+			if ok {
+				c.remove(comp, id)
+			}
+			missing = append(missing, id)
+			c.stats.Misses++
+		}
+	}
+	return fresh, stale, missing
+}
+
+// begin registers a fetch and returns the generation it started at.
+func (c *cached) begin() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetching++
+	return c.gen
+}
+
+// finish stores the fetched tasks that were not invalidated after start.
+func (c *cached) finish(comp string, start uint64, tasks ...models.Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetching--
+	now := c.now()
+	if c.size+len(tasks) > maxCacheEntries {
+		c.prune(now)
+	}
+	for _, t := range tasks {
+		if c.invalidated[t.ID] > start {
+			continue
+		}
+		c.put(comp, now, t)
+	}
+	if c.fetching == 0 {
+		c.invalidated = make(map[int64]uint64)
+	}
+}
+
+func (c *cached) put(comp string, now time.Time, t models.Task) {
+	if t.ID == 0 {
+		return
+	}
+	byCompany := c.entries[t.ID]
+	if byCompany == nil {
+		byCompany = make(map[string]cacheEntry)
+		c.entries[t.ID] = byCompany
+	}
+	if _, ok := byCompany[comp]; !ok {
+		c.size++
+	}
+	byCompany[comp] = cacheEntry{task: t, fetched: now}
+}
+
+func (c *cached) remove(comp string, id int64) {
+	byCompany := c.entries[id]
+	if _, ok := byCompany[comp]; !ok {
+		return
+	}
+	c.size--
+	delete(byCompany, comp)
+	if len(byCompany) == 0 {
+		delete(c.entries, id)
+	}
+}
+
+// prune drops expired entries, and everything when that is not enough.
+func (c *cached) prune(now time.Time) {
+	for id, byCompany := range c.entries {
+		for comp, e := range byCompany {
+			if now.Sub(e.fetched) > c.ttl+c.stale {
+				c.remove(comp, id)
+			}
+		}
+	}
+	if c.size >= maxCacheEntries {
+		c.entries = make(map[int64]map[string]cacheEntry)
+		c.size = 0
+	}
+}
+
+// revalidate refetches ids in the background with the caller's credentials.
+// Ids already being refreshed for the company are skipped, failures keep the
+// stale entries.
+func (c *cached) revalidate(ctx context.Context, ids []int64) {
+	comp := company(ctx)
+	c.mu.Lock()
+	var todo []int64
+	for _, id := range ids {
+		key := cacheKey{company: comp, id: id}
+		if !c.refreshing[key] {
+			c.refreshing[key] = true
+			todo = append(todo, id)
+		}
+	}
+	c.mu.Unlock()
+	if len(todo) == 0 {
+		return
+	}
+
+	auth, _ := ctx.Value(authKey{}).(string)
+	start := c.begin()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			for _, id := range todo {
+				delete(c.refreshing, cacheKey{company: comp, id: id})
+			}
+			c.mu.Unlock()
+		}()
+		bg := WithCompany(WithAuthorization(context.Background(), auth), comp)
+		fetched, err := c.Client.Batch(bg, todo)
+		if err != nil {
+			c.finish(comp, start)
+			c.mu.Lock()
+			c.stats.Refresh++
+			c.mu.Unlock()
+			c.log.Warnln("taskclient: cache refresh failed", err)
+			return
+		}
+		c.finish(comp, start, fetched...)
+	}()
+}
@@ -0,0 +1,329 @@
+package taskclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"projects/internal/models"
+	"projects/pkg/config"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+)
+
+// Client talks to the task service. The Authorization header of every call is
+// taken from the context, see WithAuthorization.
+type Client interface {
+	Get(ctx context.Context, id int64) (models.Task, error)
+	Batch(ctx context.Context, ids []int64) ([]models.Task, error)
+	// List returns the tasks the task service links to the milestones.
+	List(ctx context.Context, milestoneIDs []int64) ([]models.Task, error)
+	Create(ctx context.Context, task models.TaskReq) (models.Task, error)
+	Update(ctx context.Context, id int64, task models.TaskReq) (models.Task, error)
+	// Reparent changes only the epic and milestone of the task.
+	Reparent(ctx context.Context, id, epicID, milestoneID int64) error
+	Delete(ctx context.Context, id int64) error
+	// Invalidate drops cached payloads of tasks changed outside this client.
+	Invalidate(ids ...int64)
+	Metrics() Metrics
+}
+
+type Params struct {
+	fx.In
+	*config.Tuner
+	*logrus.Logger
+}
+
+const (
+	defaultTimeout          = 15 * time.Second
+	defaultRetries          = 2
+	defaultBackoff          = 200 * time.Millisecond
+	maxBackoff              = 5 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+	defaultCacheStale       = time.Hour
+)
+
+type client struct {
+	addr    string
+	http    *http.Client
+	retries int
+	backoff time.Duration
+	breaker *breaker
+	metrics *metrics
+	log     *logrus.Logger
+}
+
+func New(params Params) Client {
+	conf := params.Tuner.Task
+	c := &client{
+		addr:    conf.Addr,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		metrics: newMetrics(),
+		log:     params.Logger,
+	}
+	timeout := defaultTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	if conf.Retries > 0 {
+		c.retries = conf.Retries
+	}
+	if conf.Backoff > 0 {
+		c.backoff = time.Duration(conf.Backoff) * time.Millisecond
+	}
+	threshold, cooldown := defaultBreakerThreshold, defaultBreakerCooldown
+	if conf.BreakerThreshold > 0 {
+		threshold = conf.BreakerThreshold
+	}
+	if conf.BreakerCooldown > 0 {
+		cooldown = time.Duration(conf.BreakerCooldown) * time.Second
+	}
+	c.breaker = newBreaker(threshold, cooldown)
+	c.http = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	if conf.CacheTTL <= 0 {
+		return c
+	}
+	stale := defaultCacheStale
+	if conf.CacheStale > 0 {
+		stale = time.Duration(conf.CacheStale) * time.Second
+	}
+	return newCached(c, time.Duration(conf.CacheTTL)*time.Second, stale, params.Logger)
+}
+
+type authKey struct{}
+
+type idempotencyKey struct{}
+
+type companyKey struct{}
+
+// WithAuthorization attaches the caller's Authorization header to ctx.
+func WithAuthorization(ctx context.Context, authorization string) context.Context {
+	return context.WithValue(ctx, authKey{}, authorization)
+}
+
+// WithCompany attaches the caller's company to ctx, the task cache serves a
+// company only the payloads fetched for it.
+func WithCompany(ctx context.Context, company string) context.Context {
+	return context.WithValue(ctx, companyKey{}, company)
+}
+
+func company(ctx context.Context) string {
+	c, _ := ctx.Value(companyKey{}).(string)
+	return c
+}
+
+// WithIdempotencyKey makes the task service apply repeated calls carrying the
+// same key once. Creates are retried only when a key is set.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKey returns the key WithIdempotencyKey attached to ctx, for
+// backends that apply the calls themselves.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// WithDefaultAuthorization is WithAuthorization for contexts that carry no
+// Authorization yet, e.g. background calls without a service token.
+func WithDefaultAuthorization(ctx context.Context, authorization string) context.Context {
+	if current, _ := ctx.Value(authKey{}).(string); current != "" {
+		return ctx
+	}
+	return WithAuthorization(ctx, authorization)
+}
+
+// WithServiceAuth authorizes background calls made without a user request
+// with the configured service token.
+func WithServiceAuth(ctx context.Context, conf *config.Tuner) context.Context {
+	return WithAuthorization(ctx, conf.Task.ServiceToken)
+}
+
+func (c *client) Get(ctx context.Context, id int64) (models.Task, error) {
+	var task models.Task
+	err := c.do(ctx, "get", http.MethodGet, "/tasks/"+fmt.Sprint(id), nil, &task, true)
+	return task, err
+}
+
+func (c *client) Batch(ctx context.Context, ids []int64) ([]models.Task, error) {
+	var res []models.Task
+	if len(ids) == 0 {
+		return res, nil
+	}
+	// the batch endpoint is a read, so it is safe to repeat
+	err := c.do(ctx, "batch", http.MethodPost, "/tasks/batch", ids, &res, true)
+	return res, err
+}
+
+func (c *client) List(ctx context.Context, milestoneIDs []int64) ([]models.Task, error) {
+	var res []models.Task
+	if len(milestoneIDs) == 0 {
+		return res, nil
+	}
+	query := url.Values{}
+	for _, id := range milestoneIDs {
+		query.Add("milestone_id", fmt.Sprint(id))
+	}
+	err := c.do(ctx, "list", http.MethodGet, "/tasks?"+query.Encode(), nil, &res, true)
+	return res, err
+}
+
+func (c *client) Create(ctx context.Context, task models.TaskReq) (models.Task, error) {
+	var created models.Task
+	_, keyed := ctx.Value(idempotencyKey{}).(string)
+	if err := c.do(ctx, "create", http.MethodPost, "/tasks", task, &created, keyed); err != nil {
+		return created, err
+	}
+	if created.ID == 0 {
+		return created, &Error{Op: "create", Kind: ErrUnavailable, Body: "empty task id in response"}
+	}
+	return created, nil
+}
+
+func (c *client) Update(ctx context.Context, id int64, task models.TaskReq) (models.Task, error) {
+	var updated models.Task
+	err := c.do(ctx, "update", http.MethodPut, "/tasks/"+fmt.Sprint(id), task, &updated, true)
+	return updated, err
+}
+
+func (c *client) Reparent(ctx context.Context, id, epicID, milestoneID int64) error {
+	body := struct {
+		EpicID      int64 `json:"epic_id"`
+		MilestoneID int64 `json:"milestone_id"`
+	}{EpicID: epicID, MilestoneID: milestoneID}
+	return c.do(ctx, "update", http.MethodPut, "/tasks/"+fmt.Sprint(id), body, nil, true)
+}
+
+func (c *client) Delete(ctx context.Context, id int64) error {
+	err := c.do(ctx, "delete", http.MethodDelete, "/tasks/"+fmt.Sprint(id), nil, nil, true)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		// already gone, the end state is the same
+		return nil
+	}
+	return err
+}
+
+func (c *client) Invalidate(ids ...int64) {}
+
+func (c *client) Metrics() Metrics {
+	return c.metrics.snapshot(c.breaker.current())
+}
+
+// do sends the request, idempotent calls are repeated with exponential backoff
+// on network errors and on 429/502/503/504 answers.
+func (c *client) do(ctx context.Context, op, method, uri string, body, out interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return &Error{Op: op, Kind: ErrBadRequest, Err: err}
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += c.retries
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if waitErr := c.wait(ctx, i); waitErr != nil {
+				return &Error{Op: op, Kind: ErrUnavailable, Err: waitErr}
+			}
+		}
+		if !c.breaker.allow() {
+			c.metrics.rejected(op)
+			return &Error{Op: op, Kind: ErrCircuitOpen}
+		}
+		start := time.Now()
+		err = c.send(ctx, op, method, uri, payload, out)
+		// answers like 404 mean the service is healthy, only outages trip the breaker
+		healthy := err == nil || !errors.Is(err, ErrUnavailable)
+		if c.breaker.done(healthy) {
+			c.metrics.opened()
+			c.log.Warnln("taskclient: circuit opened after", op, err)
+		}
+		c.metrics.attempt(op, time.Since(start), err != nil, i > 0)
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *client) wait(ctx context.Context, attempt int) error {
+	d := c.backoff << uint(attempt-1)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (c *client) send(ctx context.Context, op, method, uri string, payload []byte, out interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+uri, reader)
+	if err != nil {
+		return &Error{Op: op, Kind: ErrBadRequest, Err: err}
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth, ok := ctx.Value(authKey{}).(string); ok && auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &Error{Op: op, Kind: ErrUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &Error{Op: op, StatusCode: resp.StatusCode, Kind: ErrUnavailable, Err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Error{Op: op, StatusCode: resp.StatusCode, Kind: kindOf(resp.StatusCode), Body: string(respBody)}
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return &Error{Op: op, StatusCode: resp.StatusCode, Kind: ErrUnavailable, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package taskclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound     = errors.New("task not found")
+	ErrBadRequest   = errors.New("task service rejected the request")
+	ErrUnauthorized = errors.New("task service denied access")
+	ErrConflict     = errors.New("task service conflict")
+	ErrUnavailable  = errors.New("task service unavailable")
+	ErrCircuitOpen  = errors.New("task service circuit is open")
+)
+
+// Error describes a failed call to the task service. Kind is one of the
+// sentinel errors above, so callers can use errors.Is.
+type Error struct {
+	Op         string
+	StatusCode int
+	Body       string
+	Kind       error
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("taskclient %s: %v", e.Op, e.Kind)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func kindOf(statusCode int) error {
+	switch {
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case statusCode == http.StatusConflict:
+		return ErrConflict
+	case statusCode >= 400 && statusCode < 500 && statusCode != http.StatusTooManyRequests:
+		return ErrBadRequest
+	}
+	return ErrUnavailable
+}
+
+// Status returns the status code a handler should answer with for err.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthorized):
+		var e *Error
+		if errors.As(err, &e) && e.StatusCode != 0 {
+			return e.StatusCode
+		}
+		return http.StatusForbidden
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// Temporary reports whether err is an outage of the task service, so the call
+// may succeed later.
+func Temporary(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrCircuitOpen)
+}
+
+// retryable reports whether a failed attempt may succeed when repeated.
+func retryable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.StatusCode == 0 {
+		return e.Kind == ErrUnavailable
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
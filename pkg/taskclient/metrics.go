@@ -0,0 +1,82 @@
+package taskclient
+
+import (
+	"sync"
+	"time"
+)
+
+// OpStats are the counters of one operation (create, update, ...).
+type OpStats struct {
+	Requests    int64   `json:"requests"`
+	Failures    int64   `json:"failures"`
+	Retries     int64   `json:"retries"`
+	Rejected    int64   `json:"rejected"`
+	AvgLatency  float64 `json:"avg_latency_ms"`
+	totalMillis float64
+}
+
+// Metrics - Backend names the task backend, Breaker is the state of the
+// circuit breaker of the remote client, empty for backends without one.
+type Metrics struct {
+	Backend      string             `json:"backend"`
+	Breaker      string             `json:"breaker,omitempty"`
+	BreakerOpens int64              `json:"breaker_opens"`
+	Ops          map[string]OpStats `json:"ops"`
+	Cache        *CacheStats        `json:"cache,omitempty"`
+}
+
+type metrics struct {
+	mu    sync.Mutex
+	opens int64
+	ops   map[string]*OpStats
+}
+
+func newMetrics() *metrics {
+	return &metrics{ops: make(map[string]*OpStats)}
+}
+
+func (m *metrics) op(name string) *OpStats {
+	s, ok := m.ops[name]
+	if !ok {
+		s = &OpStats{}
+		m.ops[name] = s
+	}
+	return s
+}
+
+func (m *metrics) attempt(name string, latency time.Duration, failed, retry bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.op(name)
+	s.Requests++
+	s.totalMillis += float64(latency) / float64(time.Millisecond)
+	s.AvgLatency = s.totalMillis / float64(s.Requests)
+	if failed {
+		s.Failures++
+	}
+	if retry {
+		s.Retries++
+	}
+}
+
+func (m *metrics) rejected(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.op(name).Rejected++
+}
+
+func (m *metrics) opened() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opens++
+}
+
+func (m *metrics) snapshot(state string) Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := Metrics{Backend: "remote", Breaker: state, BreakerOpens: m.opens, Ops: make(map[string]OpStats, len(m.ops))}
+	for name, s := range m.ops {
+		res.Ops[name] = *s
+	}
+	return res
+}
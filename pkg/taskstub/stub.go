@@ -0,0 +1,392 @@
+// Package taskstub is an in-memory fake of the task service for local
+// development and end-to-end tests. Stub is an http.Handler, so it runs under
+// httptest.NewServer as well as in the cmd/taskstub binary.
+package taskstub
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"projects/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options control the injected latency and failures. A FailureRate of 0.1
+// answers every tenth request on average with FailureStatus (503 by default).
+// With WebhookURL set, changes are pushed there signed with WebhookSecret,
+// the way the projects webhook endpoint expects them.
+type Options struct {
+	Latency       time.Duration
+	Jitter        time.Duration
+	FailureRate   float64
+	FailureStatus int
+	WebhookURL    string
+	WebhookSecret string
+}
+
+type Stub struct {
+	mu      sync.Mutex
+	opts    Options
+	tasks   map[int64]models.Task
+	keys    map[string]int64
+	nextID  int64
+	eventID int64
+	rnd     *rand.Rand
+	hook    *http.Client
+}
+
+func New(opts Options) *Stub {
+	return &Stub{
+		opts:   opts,
+		tasks:  make(map[int64]models.Task),
+		keys:   make(map[string]int64),
+		nextID: 1,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		hook:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Start runs the stub on a local httptest server, close it when done.
+func Start(opts Options) (*httptest.Server, *Stub) {
+	s := New(opts)
+	return httptest.NewServer(s), s
+}
+
+func (s *Stub) SetOptions(opts Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = opts
+}
+
+// Put stores tasks as they are, keeping their IDs.
+func (s *Stub) Put(tasks ...models.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tasks {
+		s.tasks[t.ID] = t
+		if t.ID >= s.nextID {
+			s.nextID = t.ID + 1
+		}
+	}
+}
+
+// Tasks returns a snapshot of the stored tasks ordered by ID.
+func (s *Stub) Tasks() []models.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]models.Task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+func (s *Stub) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = make(map[int64]models.Task)
+	s.keys = make(map[string]int64)
+	s.nextID = 1
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.inject(w) {
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/tasks" && r.Method == http.MethodPost:
+		s.create(w, r)
+	case path == "/tasks" && r.Method == http.MethodGet:
+		s.list(w, r)
+	case path == "/tasks/batch" && r.Method == http.MethodPost:
+		s.batch(w, r)
+	case strings.HasPrefix(path, "/tasks/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(path, "/tasks/"), 10, 64)
+		if err != nil {
+			http.Error(w, "wrong id", http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.get(w, id)
+		case http.MethodPut:
+			s.update(w, r, id)
+		case http.MethodDelete:
+			s.delete(w, id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// inject sleeps for the configured latency and reports whether it answered
+// with an injected failure.
+func (s *Stub) inject(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	opts := s.opts
+	delay := opts.Latency
+	if opts.Jitter > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(opts.Jitter)))
+	}
+	fail := opts.FailureRate > 0 && s.rnd.Float64() < opts.FailureRate
+	s.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if !fail {
+		return false
+	}
+	status := opts.FailureStatus
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, "injected failure", status)
+	return true
+}
+
+func (s *Stub) create(w http.ResponseWriter, r *http.Request) {
+	var req models.TaskReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	s.mu.Lock()
+	if id, ok := s.keys[key]; ok && key != "" {
+		task := s.tasks[id]
+		s.mu.Unlock()
+		writeJSON(w, task)
+		return
+	}
+	task := models.Task{
+		ID:          s.nextID,
+		MilestoneId: req.MilestoneID,
+		EpicID:      req.EpicID,
+		ProjectID:   req.ProjectID,
+		CreatorID:   req.CreatorID,
+		AssigneeId:  req.AssigneeID,
+		Title:       req.Title,
+		Description: req.Description,
+		Priority:    req.Priority,
+		Status:      req.Status,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	}
+	if task.Status == "" {
+		task.Status = "new"
+	}
+	s.nextID++
+	s.tasks[task.ID] = task
+	if key != "" {
+		s.keys[key] = task.ID
+	}
+	s.mu.Unlock()
+
+	s.notify(models.TaskCreated, task)
+	writeJSON(w, task)
+}
+
+func (s *Stub) list(w http.ResponseWriter, r *http.Request) {
+	milestones := make(map[int64]bool)
+	for _, v := range r.URL.Query()["milestone_id"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "wrong milestone_id", http.StatusBadRequest)
+			return
+		}
+		milestones[id] = true
+	}
+	res := []models.Task{}
+	for _, t := range s.Tasks() {
+		if len(milestones) == 0 || milestones[t.MilestoneId] {
+			res = append(res, t)
+		}
+	}
+	writeJSON(w, res)
+}
+
+func (s *Stub) batch(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := []models.Task{}
+	s.mu.Lock()
+	for _, id := range ids {
+		if t, ok := s.tasks[id]; ok {
+			res = append(res, t)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, res)
+}
+
+func (s *Stub) get(w http.ResponseWriter, id int64) {
+	s.mu.Lock()
+	task, ok := s.tasks[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, task)
+}
+
+// update applies the fields present in the body, so both full task requests
+// and {"epic_id", "milestone_id"} re-parenting work.
+func (s *Stub) update(w http.ResponseWriter, r *http.Request, id int64) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	task, ok := s.tasks[id]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	for name, raw := range fields {
+		var err error
+		switch name {
+		case "milestone_id":
+			err = json.Unmarshal(raw, &task.MilestoneId)
+		case "epic_id":
+			err = json.Unmarshal(raw, &task.EpicID)
+		default:
+			err = setString(&task, name, raw)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			http.Error(w, fmt.Sprintf("%s: %v", name, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if isResolved(task.Status) && task.ResolvedTime == "" {
+		task.ResolvedTime = time.Now().UTC().Format(time.RFC3339)
+	} else if !isResolved(task.Status) {
+		task.ResolvedTime = ""
+	}
+	s.tasks[id] = task
+	s.mu.Unlock()
+
+	s.notify(models.TaskUpdated, task)
+	writeJSON(w, task)
+}
+
+func (s *Stub) delete(w http.ResponseWriter, id int64) {
+	s.mu.Lock()
+	task, ok := s.tasks[id]
+	delete(s.tasks, id)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+
+	s.notify(models.TaskDeleted, task)
+	writeJSON(w, map[string]string{"success": "ok"})
+}
+
+// setString updates a string field, empty values keep the current one.
+func setString(task *models.Task, name string, raw json.RawMessage) error {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	if value == "" {
+		return nil
+	}
+	switch name {
+	case "title":
+		task.Title = value
+	case "description":
+		task.Description = value
+	case "assignee_id":
+		task.AssigneeId = value
+	case "priority":
+		task.Priority = value
+	case "status":
+		task.Status = value
+	case "start_time":
+		task.StartTime = value
+	case "end_time":
+		task.EndTime = value
+	case "project_id":
+		task.ProjectID = value
+	}
+	return nil
+}
+
+func isResolved(status string) bool {
+	switch strings.ToLower(status) {
+	case "done", "resolved", "closed", "completed":
+		return true
+	}
+	return false
+}
+
+// notify pushes a signed change event to the webhook, failures are dropped.
+func (s *Stub) notify(eventType string, task models.Task) {
+	s.mu.Lock()
+	url, secret := s.opts.WebhookURL, s.opts.WebhookSecret
+	s.eventID++
+	now := time.Now().UnixNano()
+	event := models.TaskEvent{
+		ID:         fmt.Sprintf("stub-%d-%d", now, s.eventID),
+		Type:       eventType,
+		OccurredAt: now / int64(time.Millisecond),
+		Task:       task,
+	}
+	s.mu.Unlock()
+	if url == "" {
+		return
+	}
+
+	body, _ := json.Marshal(event)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Timestamp", ts)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		if resp, err := s.hook.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}